@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"danielmatsuda15.rest/internal/data"
+)
+
+// reloadCachesHandler handles POST requests to the "/v1/caches/reload" endpoint. The cached statistics and
+// the embedded search index are only updated by writes made through this server, so this is called after
+// the titles table was changed some other way, e.g. by cmd/refresh.
+func (app *application) reloadCachesHandler(w http.ResponseWriter, r *http.Request) {
+	app.models.Stats.Flush()
+
+	env := envelope{"message": "caches reloaded"}
+	if app.search != nil {
+		err := app.rebuildSearchIndex(r.Context())
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		env["search_index_titles"] = app.search.Len()
+	}
+
+	err := app.writeResponse(w, r, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// rebuildSearchIndex replaces the contents of the embedded search index with every title in the titles table.
+func (app *application) rebuildSearchIndex(ctx context.Context) error {
+	return app.search.Rebuild(func() ([]*data.Title, error) {
+		return app.models.Titles.GetAll(ctx, data.TitleFilters{}, nil)
+	})
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"danielmatsuda15.rest/internal/data"
+	"danielmatsuda15.rest/internal/validator"
+	"github.com/julienschmidt/httprouter"
+)
+
+// listDirectorsHandler handles GET requests to the "/v1/directors" endpoint. Sends a page of the distinct
+// directors in the titles table with their number of titles, most first. The search param only lists the
+// directors whose names contain it, and the page and page_size params choose the page.
+func (app *application) listDirectorsHandler(w http.ResponseWriter, r *http.Request) {
+	queryString := r.URL.Query()
+
+	var input struct {
+		Search string
+		data.Pagination
+	}
+
+	v := validator.New()
+	input.Search = app.readString(queryString, "search", "")
+	input.Page = app.readInt(queryString, "page", 1, v)
+	input.PageSize = app.readInt(queryString, "page_size", 20, v)
+
+	if data.ValidatePagination(v, input.Pagination); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	directors, metadata, err := app.models.Directors.GetAll(r.Context(), input.Search, input.Pagination)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"directors": directors, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// showDirectorTitlesHandler handles GET requests to the "/v1/directors/:name/titles" endpoint. Sends the
+// director's filmography ordered by release_year, and the directors they've collaborated with.
+func (app *application) showDirectorTitlesHandler(w http.ResponseWriter, r *http.Request) {
+	// httprouter has already unescaped the name, e.g. "Martin%20Scorsese"
+	name := httprouter.ParamsFromContext(r.Context()).ByName("name")
+
+	titles, err := app.models.Directors.GetTitles(r.Context(), name)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	env := envelope{
+		"director":      name,
+		"titles":        titles,
+		"collaborators": data.Collaborators(name, titles),
+	}
+	err = app.writeResponse(w, r, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
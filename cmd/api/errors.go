@@ -1,8 +1,11 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
+
+	"danielmatsuda15.rest/internal/data"
 )
 
 // logError is an extensible helper method for logging an error message.
@@ -14,9 +17,9 @@ func (app *application) logError(r *http.Request, err error) {
 // messages to the client with a given status code.
 func (app *application) errorResponse(w http.ResponseWriter, r *http.Request, status int, message interface{}) {
 	env := envelope{"error": message}
-	// Write the error response using the writeJSON() helper. If this throws another
+	// Write the error response using the writeResponse() helper. If this throws another
 	// error, then log it and send an empty response with a 500 Internal Server Error status code.
-	err := app.writeJSON(w, status, env, nil)
+	err := app.writeResponse(w, r, status, env, nil)
 	if err != nil {
 		app.logError(r, err)
 		w.WriteHeader(500)
@@ -29,13 +32,44 @@ func (app *application) badRequestResponse(w http.ResponseWriter, r *http.Reques
 }
 
 // serverErrorResponse handles unexpected problems at runtime. It logs the detailed error message, then
-// sends a 500 Internal Server Error status code and JSON response to the client.
+// sends a 500 Internal Server Error status code and JSON response to the client. Queries stopped by their
+// context are handled by queryCanceledResponse() instead.
 func (app *application) serverErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	if data.Canceled(err) {
+		app.queryCanceledResponse(w, r, err)
+		return
+	}
+
 	app.logError(r, err)
 	message := "the server encountered a problem and could not process your request"
 	app.errorResponse(w, r, http.StatusInternalServerError, message)
 }
 
+// statusClientClosedRequest is nginx's non-standard status code for a request the client gave up on before
+// the response was sent.
+const statusClientClosedRequest = 499
+
+// logClientClosedRequest logs that the client went away before its request finished.
+func (app *application) logClientClosedRequest(r *http.Request) {
+	app.logger.Printf("%d client closed request: %s %s", statusClientClosedRequest, r.Method, r.URL.RequestURI())
+}
+
+// queryCanceledResponse handles a query stopped by its context. If the request's context was canceled, the
+// client has gone away: the request is logged, and its 499 status is only recorded in the metrics, since
+// there's no one left to send a response to. Otherwise the query took longer than -db-query-timeout, so a
+// 504 Gateway Timeout status code and JSON response is sent to the client.
+func (app *application) queryCanceledResponse(w http.ResponseWriter, r *http.Request, err error) {
+	if r.Context().Err() != nil {
+		app.logClientClosedRequest(r)
+		w.WriteHeader(statusClientClosedRequest)
+		return
+	}
+
+	app.logError(r, err)
+	message := "the database took too long to respond, please try again later"
+	app.errorResponse(w, r, http.StatusGatewayTimeout, message)
+}
+
 // notFoundResponse sends a 404 Not Found status code and JSON response to the client.
 func (app *application) notFoundResponse(w http.ResponseWriter, r *http.Request) {
 	message := "the requested resource could not be found"
@@ -54,8 +88,54 @@ func (app *application) failedValidationResponse(w http.ResponseWriter, r *http.
 	app.errorResponse(w, r, http.StatusUnprocessableEntity, errors)
 }
 
+// notAcceptableResponse sends a 406 Not Acceptable status code and JSON response to the client, when none of the
+// media types in its Accept header are supported.
+func (app *application) notAcceptableResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the requested media type is not supported, use one of application/json, application/xml, application/yaml, or text/csv and application/x-ndjson when listing titles"
+	app.errorResponse(w, r, http.StatusNotAcceptable, message)
+}
+
+// jobsUnavailableResponse sends a 501 Not Implemented status code and JSON response to the client, when
+// background jobs can't be stored.
+func (app *application) jobsUnavailableResponse(w http.ResponseWriter, r *http.Request) {
+	message := "background jobs need a PostgreSQL database, use POST /v1/imports to import a CSV instead"
+	app.errorResponse(w, r, http.StatusNotImplemented, message)
+}
+
 // rateLimitExceededResponse sends a 429 Too Many Requests status code and JSON response to the client.
 func (app *application) rateLimitExceededResponse(w http.ResponseWriter, r *http.Request) {
 	message := "rate limit exceeded"
 	app.errorResponse(w, r, http.StatusTooManyRequests, message)
 }
+
+// countMismatchResponse sends a 409 Conflict status code and JSON response to the client, when a bulk operation
+// would affect a different number of titles than the client expected.
+func (app *application) countMismatchResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the number of matching titles has changed since the dry run, please preview the operation again"
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
+
+// bulkErrorResponse sends the response for an error returned by a bulk update or delete.
+func (app *application) bulkErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, data.ErrCountMismatch):
+		app.countMismatchResponse(w, r)
+	default:
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// streamErrorResponse handles an error returned while streaming a response. If the response has already been
+// started, it's too late to send an error response, so the error is only logged.
+func (app *application) streamErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	var streamErr *streamError
+	if errors.As(err, &streamErr) {
+		if r.Context().Err() != nil {
+			app.logClientClosedRequest(r)
+			return
+		}
+		app.logError(r, err)
+		return
+	}
+	app.serverErrorResponse(w, r, err)
+}
@@ -0,0 +1,402 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"gopkg.in/yaml.v3"
+)
+
+/*
+Functions in this file convert the API's JSON responses to XML and YAML, and XML request bodies to JSON. JSON
+stays the API's canonical format: a response is marshaled to JSON as usual, then converted, so the JSON
+struct tags decide the field names and order in every format.
+*/
+
+// formats maps the media types a client may list in its Accept header to the response format they select.
+// csv and ndjson are only sent by the endpoints that stream lists of titles; the others send JSON instead.
+// Browsers list text/html first, and plain text clients text/plain, so they get JSON as they did before
+// the other formats were added, rather than the XML a browser also lists.
+var formats = map[string]string{
+	"application/json":     "json",
+	"text/html":            "json",
+	"text/plain":           "json",
+	"application/xml":      "xml",
+	"text/xml":             "xml",
+	"application/yaml":     "yaml",
+	"application/x-yaml":   "yaml",
+	"text/yaml":            "yaml",
+	"text/x-yaml":          "yaml",
+	"text/csv":             "csv",
+	"application/x-ndjson": "ndjson",
+}
+
+// negotiateFormat returns the response format for an Accept header: the supported media type with the
+// highest quality value, or the first of them if there's a tie. Wildcards like */* aren't ranked against
+// the listed media types; they only select JSON when none of those are supported. A missing Accept header
+// selects JSON too. Returns false if none of the listed media types are supported, and there's no wildcard.
+func negotiateFormat(accept string) (string, bool) {
+	if strings.TrimSpace(accept) == "" {
+		return "json", true
+	}
+
+	format, best := "", 0.0
+	wildcard := false
+	for _, accepted := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(accepted))
+		if err != nil {
+			continue
+		}
+
+		q := 1.0
+		if qParam, ok := params["q"]; ok {
+			q, err = strconv.ParseFloat(qParam, 64)
+			if err != nil {
+				continue
+			}
+		}
+		if q <= 0 {
+			continue
+		}
+
+		if strings.HasSuffix(mediaType, "/*") {
+			wildcard = true
+			continue
+		}
+		f, ok := formats[mediaType]
+		if !ok {
+			continue
+		}
+		if q > best {
+			format, best = f, q
+		}
+	}
+
+	if format == "" && wildcard {
+		return "json", true
+	}
+	return format, format != ""
+}
+
+// writeXML converts the JSON response js to an XML document, and writes it to w with a <response> root
+// element. Each key of the envelope becomes an element, and each item of an array becomes an <item> element.
+func writeXML(w io.Writer, js []byte) error {
+	value, err := decodeOrdered(js)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(w, xml.Header)
+	if err != nil {
+		return err
+	}
+
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "\t")
+	err = encodeXML(enc, "response", value)
+	if err != nil {
+		return err
+	}
+	err = enc.Flush()
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(w, "\n")
+	return err
+}
+
+// writeYAML converts the JSON response js to a YAML document, and writes it to w.
+func writeYAML(w io.Writer, js []byte) error {
+	value, err := decodeOrdered(js)
+	if err != nil {
+		return err
+	}
+
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	err = enc.Encode(yamlNode(value))
+	if err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// jsonField is a key/value pair of a JSON object.
+type jsonField struct {
+	key   string
+	value interface{}
+}
+
+// jsonObject is a JSON object that keeps its keys in their original order, unlike map[string]interface{}.
+type jsonObject []jsonField
+
+// decodeOrdered decodes js into jsonObject, []interface{}, string, json.Number, bool and nil values.
+func decodeOrdered(js []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(js))
+	dec.UseNumber()
+	return decodeValue(dec)
+}
+
+func decodeValue(dec *json.Decoder) (interface{}, error) {
+	token, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch token {
+	case json.Delim('{'):
+		object := jsonObject{}
+		for dec.More() {
+			key, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			value, err := decodeValue(dec)
+			if err != nil {
+				return nil, err
+			}
+			object = append(object, jsonField{key: key.(string), value: value})
+		}
+		// read the closing '}'
+		_, err = dec.Token()
+		return object, err
+	case json.Delim('['):
+		array := []interface{}{}
+		for dec.More() {
+			value, err := decodeValue(dec)
+			if err != nil {
+				return nil, err
+			}
+			array = append(array, value)
+		}
+		// read the closing ']'
+		_, err = dec.Token()
+		return array, err
+	default:
+		return token, nil
+	}
+}
+
+// encodeXML writes value to enc as an element with the given name. Keys that aren't valid XML names, like a
+// country or a year, are written as <entry key="..."> elements instead.
+func encodeXML(enc *xml.Encoder, name string, value interface{}) error {
+	start := xml.StartElement{Name: xml.Name{Local: name}}
+	if !validXMLName(name) {
+		start = xml.StartElement{
+			Name: xml.Name{Local: "entry"},
+			Attr: []xml.Attr{{Name: xml.Name{Local: "key"}, Value: name}},
+		}
+	}
+
+	err := enc.EncodeToken(start)
+	if err != nil {
+		return err
+	}
+
+	switch value := value.(type) {
+	case jsonObject:
+		for _, field := range value {
+			err := encodeXML(enc, field.key, field.value)
+			if err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for _, item := range value {
+			err := encodeXML(enc, "item", item)
+			if err != nil {
+				return err
+			}
+		}
+	case nil:
+		// a null is an empty element
+	default:
+		err := enc.EncodeToken(xml.CharData(fmt.Sprint(value)))
+		if err != nil {
+			return err
+		}
+	}
+
+	return enc.EncodeToken(start.End())
+}
+
+// validXMLName reports whether name can be used as an XML element name.
+func validXMLName(name string) bool {
+	if name == "" || strings.HasPrefix(strings.ToLower(name), "xml") {
+		return false
+	}
+	for i, r := range name {
+		switch {
+		case unicode.IsLetter(r) || r == '_':
+		case i > 0 && (unicode.IsDigit(r) || r == '-' || r == '.'):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// yamlNode converts a value from decodeOrdered() to a YAML node, keeping the order of object keys.
+func yamlNode(value interface{}) *yaml.Node {
+	switch value := value.(type) {
+	case jsonObject:
+		node := &yaml.Node{Kind: yaml.MappingNode}
+		for _, field := range value {
+			node.Content = append(node.Content,
+				&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: field.key},
+				yamlNode(field.value))
+		}
+		return node
+	case []interface{}:
+		node := &yaml.Node{Kind: yaml.SequenceNode}
+		for _, item := range value {
+			node.Content = append(node.Content, yamlNode(item))
+		}
+		return node
+	case json.Number:
+		if _, err := value.Int64(); err == nil {
+			return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!int", Value: value.String()}
+		}
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!float", Value: value.String()}
+	case bool:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!bool", Value: strconv.FormatBool(value)}
+	case nil:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null", Value: "null"}
+	default:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: fmt.Sprint(value)}
+	}
+}
+
+// xmlElement is an element of an XML request body, with its text or its child elements.
+type xmlElement struct {
+	name     string
+	text     string
+	children []*xmlElement
+}
+
+// parseXML reads a single root element, and everything inside it, from r.
+func parseXML(r io.Reader) (*xmlElement, error) {
+	dec := xml.NewDecoder(r)
+
+	var root *xmlElement
+	stack := []*xmlElement{}
+	for {
+		token, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch token := token.(type) {
+		case xml.StartElement:
+			if root != nil && len(stack) == 0 {
+				return nil, errors.New("body must only contain a single XML element")
+			}
+			element := &xmlElement{name: token.Name.Local}
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, element)
+			} else {
+				root = element
+			}
+			stack = append(stack, element)
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			if len(stack) > 0 {
+				stack[len(stack)-1].text += string(token)
+			}
+		}
+	}
+
+	if root == nil {
+		return nil, io.EOF
+	}
+	return root, nil
+}
+
+// xmlToJSON converts element to a value that marshals to the JSON that would be decoded into a value of
+// type t. The JSON struct tags of t decide which child elements are fields, and whether an element's text
+// is a string, number or boolean. Elements that don't match a field are kept as strings, so decoding the
+// JSON rejects them as unknown keys.
+func xmlToJSON(element *xmlElement, t reflect.Type) interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	text := strings.TrimSpace(element.text)
+	switch t.Kind() {
+	case reflect.Struct:
+		fields := jsonFieldTypes(t)
+		object := make(map[string]interface{})
+		for _, child := range element.children {
+			fieldType, ok := fields[child.name]
+			if !ok {
+				object[child.name] = child.text
+				continue
+			}
+			object[child.name] = xmlToJSON(child, fieldType)
+		}
+		return object
+	case reflect.Slice:
+		array := []interface{}{}
+		for _, child := range element.children {
+			array = append(array, xmlToJSON(child, t.Elem()))
+		}
+		return array
+	case reflect.Bool:
+		if b, err := strconv.ParseBool(text); err == nil {
+			return b
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		if _, err := strconv.ParseFloat(text, 64); err == nil {
+			return json.Number(text)
+		}
+	case reflect.String:
+		return element.text
+	}
+
+	// a value that doesn't match the field's type is sent as a string, so decoding the JSON reports the
+	// incorrect type for the field
+	return element.text
+}
+
+// jsonFieldTypes maps the JSON key of each of t's fields to the field's type, including the fields of
+// embedded structs.
+func jsonFieldTypes(t reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+
+		name := strings.Split(tag, ",")[0]
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			for key, fieldType := range jsonFieldTypes(field.Type) {
+				fields[key] = fieldType
+			}
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fields[name] = field.Type
+	}
+	return fields
+}
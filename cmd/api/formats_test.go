@@ -0,0 +1,36 @@
+package main
+
+import "testing"
+
+func TestNegotiateFormat(t *testing.T) {
+	tests := []struct {
+		name   string
+		accept string
+		format string
+		ok     bool
+	}{
+		{"missing", "", "json", true},
+		{"any", "*/*", "json", true},
+		{"json", "application/json", "json", true},
+		{"xml", "application/xml", "xml", true},
+		{"yaml", "text/yaml", "yaml", true},
+		{"csv", "text/csv", "csv", true},
+		{"browser", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", "json", true},
+		{"plain text", "text/plain", "json", true},
+		{"higher quality wins", "application/json;q=0.5, application/xml", "xml", true},
+		{"tie goes to the first", "application/yaml, application/json", "yaml", true},
+		{"wildcard isn't ranked", "application/yaml;q=0.1, */*", "yaml", true},
+		{"unsupported with wildcard", "image/png, */*;q=0.1", "json", true},
+		{"unsupported", "image/png", "", false},
+		{"refused", "application/json;q=0", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			format, ok := negotiateFormat(tt.accept)
+			if format != tt.format || ok != tt.ok {
+				t.Errorf("negotiateFormat(%q) = %q, %v; want %q, %v", tt.accept, format, ok, tt.format, tt.ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,326 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"danielmatsuda15.rest/internal/data"
+)
+
+// routes() publishes expvar metrics, which panics if it's done twice, so every test shares one handler and
+// swaps in fresh models instead.
+var (
+	testApp     = &application{logger: log.New(ioutil.Discard, "", 0), random: rand.New(rand.NewSource(1))}
+	testHandler http.Handler
+	testOnce    sync.Once
+)
+
+// newTestServer returns a handler for the API, backed by an empty in-memory title store.
+func newTestServer(t *testing.T) http.Handler {
+	t.Helper()
+
+	testOnce.Do(func() {
+		testApp.config.limiter.rps = 1000
+		testApp.config.limiter.burst = 1000
+		testApp.config.search.backend = "postgres"
+		testHandler = testApp.routes()
+	})
+	testApp.models = data.NewMemoryModels()
+	return testHandler
+}
+
+// do sends a request to h, and decodes the JSON response body into dst, if it isn't nil.
+func do(t *testing.T, h http.Handler, method, target, body string, dst interface{}) int {
+	t.Helper()
+
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	if dst != nil {
+		if err := json.Unmarshal(w.Body.Bytes(), dst); err != nil {
+			t.Fatalf("%s %s: decoding %q: %v", method, target, w.Body.String(), err)
+		}
+	}
+	return w.Code
+}
+
+// createTitle creates a title through the API, and returns its id.
+func createTitle(t *testing.T, h http.Handler, body string) int64 {
+	t.Helper()
+
+	var resp struct {
+		Title data.Title `json:"title"`
+	}
+	if code := do(t, h, http.MethodPost, "/v1/titles", body, &resp); code != http.StatusCreated {
+		t.Fatalf("POST /v1/titles: got status %d, want %d", code, http.StatusCreated)
+	}
+	return resp.Title.ID
+}
+
+func TestCreateAndShowTitle(t *testing.T) {
+	h := newTestServer(t)
+
+	id := createTitle(t, h, `{"title_type": "Movie", "title": "Roma", "director": "Alfonso Cuarón", "country": "Mexico", "release_year": 2018}`)
+
+	var resp struct {
+		Title data.Title `json:"title"`
+	}
+	if code := do(t, h, http.MethodGet, "/v1/titles/1", "", &resp); code != http.StatusOK {
+		t.Fatalf("got status %d, want %d", code, http.StatusOK)
+	}
+	want := data.Title{ID: id, TitleType: "Movie", Title: "Roma", Director: "Alfonso Cuarón", Country: "Mexico", ReleaseYear: 2018}
+	if resp.Title != want {
+		t.Errorf("got %+v, want %+v", resp.Title, want)
+	}
+}
+
+func TestCreateTitleValidation(t *testing.T) {
+	h := newTestServer(t)
+
+	var resp struct {
+		Error map[string]string `json:"error"`
+	}
+	code := do(t, h, http.MethodPost, "/v1/titles", `{"title_type": "Movie", "title": "Roma", "release_year": 1700}`, &resp)
+	if code != http.StatusUnprocessableEntity {
+		t.Fatalf("got status %d, want %d", code, http.StatusUnprocessableEntity)
+	}
+	for _, key := range []string{"director", "country", "release_year"} {
+		if resp.Error[key] == "" {
+			t.Errorf("no error for %s in %v", key, resp.Error)
+		}
+	}
+}
+
+func TestListTitlesFilters(t *testing.T) {
+	h := newTestServer(t)
+
+	createTitle(t, h, `{"title_type": "Movie", "title": "Roma", "director": "Alfonso Cuarón", "country": "Mexico", "release_year": 2018}`)
+	createTitle(t, h, `{"title_type": "Movie", "title": "Gravity", "director": "Alfonso Cuarón", "country": "United States", "release_year": 2013}`)
+	createTitle(t, h, `{"title_type": "TV Show", "title": "Narcos", "director": "José Padilha", "country": "United States", "release_year": 2015}`)
+
+	tests := []struct {
+		name   string
+		target string
+		want   []string
+	}{
+		{"all", "/v1/titles", []string{"Roma", "Gravity", "Narcos"}},
+		{"title type", "/v1/titles?title_type=Movie", []string{"Roma", "Gravity"}},
+		{"director", "/v1/titles?director=Alfonso+Cuar%C3%B3n", []string{"Roma", "Gravity"}},
+		{"country", "/v1/titles?country=United+States", []string{"Gravity", "Narcos"}},
+		{"combined", "/v1/titles?title_type=Movie&country=United+States", []string{"Gravity"}},
+		{"no match", "/v1/titles?country=Japan", []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var resp struct {
+				Titles []data.Title `json:"titles"`
+			}
+			if code := do(t, h, http.MethodGet, tt.target, "", &resp); code != http.StatusOK {
+				t.Fatalf("got status %d, want %d", code, http.StatusOK)
+			}
+			got := []string{}
+			for _, title := range resp.Titles {
+				got = append(got, title.Title)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTitleNotFound(t *testing.T) {
+	h := newTestServer(t)
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		body   string
+	}{
+		{"show missing id", http.MethodGet, "/v1/titles/42", ""},
+		{"show invalid id", http.MethodGet, "/v1/titles/abc", ""},
+		{"update missing id", http.MethodPut, "/v1/titles/42", `{"title_type": "Movie", "title": "Roma", "director": "Alfonso Cuarón", "country": "Mexico", "release_year": 2018}`},
+		{"delete missing id", http.MethodDelete, "/v1/titles/42", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code := do(t, h, tt.method, tt.target, tt.body, nil); code != http.StatusNotFound {
+				t.Errorf("got status %d, want %d", code, http.StatusNotFound)
+			}
+		})
+	}
+}
+
+func TestUpdateTitle(t *testing.T) {
+	h := newTestServer(t)
+
+	id := createTitle(t, h, `{"title_type": "Movie", "title": "Roma", "director": "Alfonso Cuarón", "country": "Mexico", "release_year": 2018}`)
+
+	code := do(t, h, http.MethodPut, "/v1/titles/1", `{"title_type": "Movie", "title": "Roma", "director": "Alfonso Cuarón", "country": "Mexico, United States", "release_year": 2018}`, nil)
+	if code != http.StatusOK {
+		t.Fatalf("got status %d, want %d", code, http.StatusOK)
+	}
+
+	var resp struct {
+		Title data.Title `json:"title"`
+	}
+	do(t, h, http.MethodGet, "/v1/titles/1", "", &resp)
+	if resp.Title.ID != id || resp.Title.Country != "Mexico, United States" {
+		t.Errorf("got %+v, want the updated country", resp.Title)
+	}
+}
+
+func TestReloadCaches(t *testing.T) {
+	h := newTestServer(t)
+
+	createTitle(t, h, `{"title_type": "Movie", "title": "Roma", "director": "Alfonso Cuarón", "country": "Mexico", "release_year": 2018}`)
+
+	var resp struct {
+		Message string `json:"message"`
+	}
+	if code := do(t, h, http.MethodPost, "/v1/caches/reload", "", &resp); code != http.StatusOK {
+		t.Fatalf("got status %d, want %d", code, http.StatusOK)
+	}
+	if resp.Message != "caches reloaded" {
+		t.Errorf("got message %q", resp.Message)
+	}
+}
+
+func TestRandomTitlesSeed(t *testing.T) {
+	h := newTestServer(t)
+
+	createTitle(t, h, `{"title_type": "Movie", "title": "Roma", "director": "Alfonso Cuarón", "country": "Mexico", "release_year": 2018}`)
+	createTitle(t, h, `{"title_type": "Movie", "title": "Gravity", "director": "Alfonso Cuarón", "country": "United States", "release_year": 2013}`)
+
+	tests := []struct {
+		name   string
+		target string
+		want   int
+	}{
+		{"generated seed", "/v1/titles/random", http.StatusOK},
+		{"seed", "/v1/titles/random?seed=42", http.StatusOK},
+		{"largest seed", "/v1/titles/random?seed=9007199254740992", http.StatusOK},
+		{"smallest seed", "/v1/titles/random?seed=-9007199254740992", http.StatusOK},
+		{"seed too large", "/v1/titles/random?seed=9007199254740993", http.StatusUnprocessableEntity},
+		{"seed too small", "/v1/titles/random?seed=-9007199254740993", http.StatusUnprocessableEntity},
+		{"seed not an integer", "/v1/titles/random?seed=abc", http.StatusUnprocessableEntity},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code := do(t, h, http.MethodGet, tt.target, "", nil); code != tt.want {
+				t.Errorf("got status %d, want %d", code, tt.want)
+			}
+		})
+	}
+}
+
+func TestListTitlesByID(t *testing.T) {
+	h := newTestServer(t)
+
+	createTitle(t, h, `{"title_type": "Movie", "title": "Roma", "director": "Alfonso Cuarón", "country": "Mexico", "release_year": 2018}`)
+	createTitle(t, h, `{"title_type": "Movie", "title": "Gravity", "director": "Alfonso Cuarón", "country": "United States", "release_year": 2013}`)
+
+	var resp struct {
+		Titles     []map[string]interface{} `json:"titles"`
+		MissingIDs []int64                  `json:"missing_ids"`
+	}
+	if code := do(t, h, http.MethodGet, "/v1/titles?ids=2,9,1&fields=title", "", &resp); code != http.StatusOK {
+		t.Fatalf("got status %d, want %d", code, http.StatusOK)
+	}
+
+	if len(resp.Titles) != 2 || resp.Titles[0]["title"] != "Gravity" || resp.Titles[1]["title"] != "Roma" {
+		t.Errorf("got titles %v, want Gravity then Roma", resp.Titles)
+	}
+	for _, title := range resp.Titles {
+		if len(title) != 1 {
+			t.Errorf("got fields %v, want only title", title)
+		}
+	}
+	if len(resp.MissingIDs) != 1 || resp.MissingIDs[0] != 9 {
+		t.Errorf("got missing_ids %v, want [9]", resp.MissingIDs)
+	}
+}
+
+func TestListTitlesByIDFormats(t *testing.T) {
+	h := newTestServer(t)
+
+	createTitle(t, h, `{"title_type": "Movie", "title": "Roma", "director": "Alfonso Cuarón", "country": "Mexico", "release_year": 2018}`)
+	createTitle(t, h, `{"title_type": "Movie", "title": "Gravity", "director": "Alfonso Cuarón", "country": "United States", "release_year": 2013}`)
+
+	tests := []struct {
+		name   string
+		target string
+		want   string
+	}{
+		{"csv", "/v1/titles?ids=2,1&fields=id,title&format=csv", "id,title\n2,Gravity\n1,Roma\n"},
+		{"ndjson", "/v1/titles?ids=2,1&fields=id,title&format=ndjson", "{\"id\":2,\"title\":\"Gravity\"}\n{\"id\":1,\"title\":\"Roma\"}\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("got status %d, want %d", w.Code, http.StatusOK)
+			}
+			if w.Body.String() != tt.want {
+				t.Errorf("got body %q, want %q", w.Body.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestListTitlesByIDLimit(t *testing.T) {
+	h := newTestServer(t)
+
+	ids := make([]string, maxBatchIDs+1)
+	for i := range ids {
+		ids[i] = "x"
+	}
+
+	var resp struct {
+		Error map[string]string `json:"error"`
+	}
+	// the ids aren't valid either, but the list is rejected for its length before they're parsed
+	code := do(t, h, http.MethodGet, "/v1/titles?ids="+strings.Join(ids, ","), "", &resp)
+	if code != http.StatusUnprocessableEntity {
+		t.Fatalf("got status %d, want %d", code, http.StatusUnprocessableEntity)
+	}
+	if resp.Error["ids"] != "must not contain more than 100 ids" {
+		t.Errorf("got error %q", resp.Error["ids"])
+	}
+}
+
+func TestExportTitlesCSVEscapesFormulas(t *testing.T) {
+	titles := []*data.Title{
+		{ID: 1, TitleType: "Movie", Title: `=HYPERLINK("http://example.com")`, Director: "+1", Country: "-1", ReleaseYear: 2018},
+		{ID: 2, TitleType: "Movie", Title: "@SUM(A1)", Director: "\tTab", Country: "Mexico", ReleaseYear: 2013},
+	}
+
+	var buf strings.Builder
+	err := exportTitlesCSV(&buf, titles, func(int) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "id,title_type,title,director,country,release_year\n" +
+		"1,Movie,\"'=HYPERLINK(\"\"http://example.com\"\")\",'+1,'-1,2018\n" +
+		"2,Movie,'@SUM(A1),'\tTab,Mexico,2013\n"
+	if buf.String() != want {
+		t.Errorf("got %q, want %q", buf.String(), want)
+	}
+}
@@ -1,15 +1,23 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
 	"encoding/json"
+	"encoding/xml"
 	"errors"
 	"fmt"
 	"io"
+	"mime"
 	"net/http"
 	"net/url"
+	"reflect"
 	"strconv"
 	"strings"
 
+	"danielmatsuda15.rest/internal/data"
+	"danielmatsuda15.rest/internal/validator"
 	"github.com/julienschmidt/httprouter"
 )
 
@@ -31,6 +39,43 @@ func (app *application) readIDParam(r *http.Request) (int64, error) {
 // used to envelop the JSON response before it is sent
 type envelope map[string]interface{}
 
+// writeResponse writes data in the format chosen by the request's Accept header: XML, YAML, or JSON by
+// default. Takes the same arguments as writeJSON(), plus the request.
+func (app *application) writeResponse(w http.ResponseWriter, r *http.Request, status int, data envelope, headers http.Header) error {
+	format, _ := negotiateFormat(r.Header.Get("Accept"))
+
+	var writeDoc func(io.Writer, []byte) error
+	var contentType string
+	switch format {
+	case "xml":
+		writeDoc, contentType = writeXML, "application/xml; charset=utf-8"
+	case "yaml":
+		writeDoc, contentType = writeYAML, "application/yaml"
+	default:
+		return app.writeJSON(w, status, data, headers)
+	}
+
+	js, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	// convert the whole document before writing any of it, so an error can still be sent as a response
+	var buf bytes.Buffer
+	err = writeDoc(&buf, js)
+	if err != nil {
+		return err
+	}
+
+	for key, value := range headers {
+		w.Header()[key] = value
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(status)
+	w.Write(buf.Bytes())
+
+	return nil
+}
+
 // writeJSON writes data as JSON to stdout. Takes the destination
 // http.ResponseWriter, the HTTP status code to send, the data to encode to JSON, and a
 // header map containing any additional HTTP headers we want to include in the response.
@@ -56,6 +101,199 @@ func (app *application) writeJSON(w http.ResponseWriter, status int, data envelo
 	return nil
 }
 
+// streamFlushRows is how many rows a streamed response buffers before flushing them to the client.
+const streamFlushRows = 500
+
+// streamResponse is an io.Writer for a response body that's streamed row by row. The status code and headers
+// aren't sent until the first write, so an error before then can still be sent as an error response.
+type streamResponse struct {
+	w           http.ResponseWriter
+	status      int
+	contentType string
+	headers     http.Header
+	started     bool
+	rows        int
+}
+
+func (s *streamResponse) Write(b []byte) (int, error) {
+	s.start()
+	return s.w.Write(b)
+}
+
+// start sends the status code and headers, if they haven't been sent yet.
+func (s *streamResponse) start() {
+	if s.started {
+		return
+	}
+	for key, value := range s.headers {
+		s.w.Header()[key] = value
+	}
+	s.w.Header().Set("Content-Type", s.contentType)
+	s.w.WriteHeader(s.status)
+	s.started = true
+}
+
+// row counts a written row, and reports whether it's time to flush the buffered rows.
+func (s *streamResponse) row() bool {
+	s.rows++
+	return s.rows%streamFlushRows == 0
+}
+
+// flush sends any rows the http.ResponseWriter has buffered to the client.
+func (s *streamResponse) flush() {
+	if f, ok := s.w.(http.Flusher); ok && s.started {
+		f.Flush()
+	}
+}
+
+// streamError wraps an error that happened after a streamed response was started, when it's too late to
+// send an error response instead.
+type streamError struct {
+	err error
+}
+
+func (e *streamError) Error() string {
+	return fmt.Sprintf("streamed response interrupted: %v", e.err)
+}
+
+func (e *streamError) Unwrap() error {
+	return e.err
+}
+
+// finish returns err, wrapped in a streamError if the response has already been started. If there's no
+// error, the response is started, in case there were no rows to write.
+func (s *streamResponse) finish(err error) error {
+	if err != nil {
+		if s.started {
+			return &streamError{err: err}
+		}
+		return err
+	}
+	s.start()
+	return nil
+}
+
+// writeCSV writes a CSV response, starting with the header row. rows calls write for each row in turn, so
+// the rows can be streamed to the client as they're produced rather than collected first. If an error is
+// returned after the response has been started, it's a *streamError (see streamErrorResponse()).
+func (app *application) writeCSV(w http.ResponseWriter, status int, header []string, rows func(write func([]string) error) error, headers http.Header) error {
+	s := &streamResponse{w: w, status: status, contentType: "text/csv; charset=utf-8", headers: headers}
+
+	cw := csv.NewWriter(s)
+	err := cw.Write(header)
+	if err != nil {
+		return s.finish(err)
+	}
+
+	err = rows(func(record []string) error {
+		err := cw.Write(record)
+		if err != nil {
+			return err
+		}
+		if s.row() {
+			cw.Flush()
+			s.flush()
+		}
+		return cw.Error()
+	})
+	if err == nil {
+		cw.Flush()
+		err = cw.Error()
+	}
+	return s.finish(err)
+}
+
+// writeNDJSON writes a newline-delimited JSON response, with one JSON value per line. values calls write for
+// each value in turn, so they can be streamed to the client as they're produced rather than collected
+// first. If an error is returned after the response has been started, it's a *streamError (see
+// streamErrorResponse()).
+func (app *application) writeNDJSON(w http.ResponseWriter, status int, values func(write func(interface{}) error) error, headers http.Header) error {
+	s := &streamResponse{w: w, status: status, contentType: "application/x-ndjson", headers: headers}
+
+	// buffer the encoded lines, so each one isn't a separate write to the connection
+	buf := bufio.NewWriter(s)
+	enc := json.NewEncoder(buf)
+
+	err := values(func(value interface{}) error {
+		// Encode() ends each value with a newline
+		err := enc.Encode(value)
+		if err != nil {
+			return err
+		}
+		if s.row() {
+			err = buf.Flush()
+			s.flush()
+		}
+		return err
+	})
+	if err == nil {
+		err = buf.Flush()
+	}
+	return s.finish(err)
+}
+
+// responseFormat returns the response format the client asked for: the format query string param if it's
+// given, or else "csv" or "ndjson" if the Accept header prefers text/csv or application/x-ndjson, or "json".
+// An unsupported format param is recorded in the Validator instance.
+func (app *application) responseFormat(r *http.Request, v *validator.Validator) string {
+	format := r.URL.Query().Get("format")
+	if format != "" {
+		v.Check(validator.In(format, "json", "csv", "ndjson"), "format", "must be one of json, csv, ndjson")
+		return format
+	}
+
+	format, _ = negotiateFormat(r.Header.Get("Accept"))
+	if format == "csv" || format == "ndjson" {
+		return format
+	}
+	return "json"
+}
+
+// readInput reads a request body into dst: as XML if the Content-Type is application/xml or text/xml, or
+// else as JSON.
+func (app *application) readInput(w http.ResponseWriter, r *http.Request, dst interface{}) error {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "application/xml" || mediaType == "text/xml" {
+		return app.readXML(w, r, dst)
+	}
+	return app.readJSON(w, r, dst)
+}
+
+// readXML reads an XML request body into dst. The body is converted to the JSON it represents, using dst's
+// JSON struct tags, then decoded the same way as readJSON(), so the same fields are accepted and the same
+// limits apply. The root element may have any name, and its child elements are dst's fields, or the items
+// of a slice.
+func (app *application) readXML(w http.ResponseWriter, r *http.Request, dst interface{}) error {
+	maxBytes := 1_048_576
+	r.Body = http.MaxBytesReader(w, r.Body, int64(maxBytes))
+
+	root, err := parseXML(r.Body)
+	if err != nil {
+		var syntaxError *xml.SyntaxError
+		switch {
+		case errors.As(err, &syntaxError):
+			return fmt.Errorf("body contains badly-formed XML (at line %d)", syntaxError.Line)
+		default:
+			return decodeJSONError(err, maxBytes)
+		}
+	}
+
+	js, err := json.Marshal(xmlToJSON(root, reflect.TypeOf(dst)))
+	if err != nil {
+		return err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(js))
+	dec.DisallowUnknownFields()
+
+	err = dec.Decode(dst)
+	if err != nil {
+		// the client sent XML, so refer to it in the message
+		return errors.New(strings.Replace(decodeJSONError(err, maxBytes).Error(), "JSON", "XML", 1))
+	}
+	return nil
+}
+
 // readJSON reads JSON from a POST request into the dst interface. The method provides error handling
 // for invalid requests, limits the max request body size, disallows unknown fields, and
 // allows only one JSON object in the request body.
@@ -71,40 +309,7 @@ func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dst int
 	// Decode the request body to the destination
 	err := dec.Decode(dst)
 	if err != nil {
-		// handle client errors
-		var syntaxError *json.SyntaxError
-		var unmarshalTypeError *json.UnmarshalTypeError
-		var invalidUnmarshalError *json.InvalidUnmarshalError
-		switch {
-		case errors.As(err, &syntaxError):
-			return fmt.Errorf("body contains badly-formed JSON (at character %d)", syntaxError.Offset)
-		case errors.Is(err, io.ErrUnexpectedEOF):
-			return errors.New("body contains badly-formed JSON")
-		case errors.As(err, &unmarshalTypeError):
-			if unmarshalTypeError.Field != "" {
-				return fmt.Errorf("body contains incorrect JSON type for field %q", unmarshalTypeError.Field)
-			}
-			return fmt.Errorf("body contains incorrect JSON type (at character %d)", unmarshalTypeError.Offset)
-		case errors.Is(err, io.EOF):
-			return errors.New("body must not be empty")
-
-		// If the JSON contains a field which cannot be mapped to the target destination
-		// then Decode() will now return an error message in the format "json: unknown
-		// field "<name>"".
-		case strings.HasPrefix(err.Error(), "json: unknown field "):
-			// in this case, extract the field name from the error,
-			// and interpolate it into our custom error message.
-			fieldName := strings.TrimPrefix(err.Error(), "json: unknown field ")
-			return fmt.Errorf("body contains unknown key %s", fieldName)
-
-		// If the request body exceeds 1MB in size, the decode will fail
-		case err.Error() == "http: request body too large":
-			return fmt.Errorf("body must not be larger than %d bytes", maxBytes)
-		case errors.As(err, &invalidUnmarshalError):
-			panic(err)
-		default:
-			return err
-		}
+		return decodeJSONError(err, maxBytes)
 	}
 	// to ensure the request contains only one JSON object, decode again and cause an io.EOF error.
 	// otherwise, return a custom error message
@@ -115,6 +320,75 @@ func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dst int
 	return nil
 }
 
+// readNDJSON reads newline-delimited JSON (one JSON value per line) from a POST request into dst, which must
+// be a pointer to a slice. Each value is decoded into a new element of the slice. The same errors are handled
+// as in readJSON(), and the same limits apply, except that the body may hold any number of values.
+func (app *application) readNDJSON(w http.ResponseWriter, r *http.Request, dst interface{}) error {
+	maxBytes := 1_048_576
+	r.Body = http.MaxBytesReader(w, r.Body, int64(maxBytes))
+
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+
+	// use reflection to append a new element to the dst slice for each value
+	slice := reflect.ValueOf(dst).Elem()
+	for {
+		elem := reflect.New(slice.Type().Elem())
+		err := dec.Decode(elem.Interface())
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("line %d: %w", slice.Len()+1, decodeJSONError(err, maxBytes))
+		}
+		slice.Set(reflect.Append(slice, elem.Elem()))
+	}
+
+	if slice.Len() == 0 {
+		return errors.New("body must not be empty")
+	}
+	return nil
+}
+
+// decodeJSONError converts an error from decoding a JSON request body into a message for the client.
+// maxBytes is the body size limit, for the message sent when it's exceeded.
+func decodeJSONError(err error, maxBytes int) error {
+	// handle client errors
+	var syntaxError *json.SyntaxError
+	var unmarshalTypeError *json.UnmarshalTypeError
+	var invalidUnmarshalError *json.InvalidUnmarshalError
+	switch {
+	case errors.As(err, &syntaxError):
+		return fmt.Errorf("body contains badly-formed JSON (at character %d)", syntaxError.Offset)
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return errors.New("body contains badly-formed JSON")
+	case errors.As(err, &unmarshalTypeError):
+		if unmarshalTypeError.Field != "" {
+			return fmt.Errorf("body contains incorrect JSON type for field %q", unmarshalTypeError.Field)
+		}
+		return fmt.Errorf("body contains incorrect JSON type (at character %d)", unmarshalTypeError.Offset)
+	case errors.Is(err, io.EOF):
+		return errors.New("body must not be empty")
+
+	// If the JSON contains a field which cannot be mapped to the target destination
+	// then Decode() will now return an error message in the format "json: unknown
+	// field "<name>"".
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		// in this case, extract the field name from the error,
+		// and interpolate it into our custom error message.
+		fieldName := strings.TrimPrefix(err.Error(), "json: unknown field ")
+		return fmt.Errorf("body contains unknown key %s", fieldName)
+
+	// If the request body exceeds 1MB in size, the decode will fail
+	case err.Error() == "http: request body too large":
+		return fmt.Errorf("body must not be larger than %d bytes", maxBytes)
+	case errors.As(err, &invalidUnmarshalError):
+		panic(err)
+	default:
+		return err
+	}
+}
+
 // readString returns a string value from the query string, or the defaultValue if no matching key could be found.
 func (app *application) readString(queryString url.Values, key string, defaultValue string) string {
 	// extract the value from the query string for the given key. Returns "" if not found
@@ -124,3 +398,130 @@ func (app *application) readString(queryString url.Values, key string, defaultVa
 	}
 	return stringVal
 }
+
+// readCSV splits a comma-separated value from the query string into a slice, or returns the defaultValue if
+// no matching key could be found.
+func (app *application) readCSV(queryString url.Values, key string, defaultValue []string) []string {
+	csv := queryString.Get(key)
+	if csv == "" {
+		return defaultValue
+	}
+	return strings.Split(csv, ",")
+}
+
+// readBool returns a bool value from the query string, or the defaultValue if no matching key could be found.
+// If the value can't be converted to a bool, an error message is recorded in the Validator instance.
+func (app *application) readBool(queryString url.Values, key string, defaultValue bool, v *validator.Validator) bool {
+	stringVal := queryString.Get(key)
+	if stringVal == "" {
+		return defaultValue
+	}
+
+	boolVal, err := strconv.ParseBool(stringVal)
+	if err != nil {
+		v.AddError(key, "must be a boolean value")
+		return defaultValue
+	}
+	return boolVal
+}
+
+// readInt returns an int value from the query string, or the defaultValue if no matching key could be found.
+// If the value can't be converted to an int, an error message is recorded in the Validator instance.
+func (app *application) readInt(queryString url.Values, key string, defaultValue int, v *validator.Validator) int {
+	stringVal := queryString.Get(key)
+	if stringVal == "" {
+		return defaultValue
+	}
+
+	intVal, err := strconv.Atoi(stringVal)
+	if err != nil {
+		v.AddError(key, "must be an integer value")
+		return defaultValue
+	}
+	return intVal
+}
+
+// readTitleFilters reads the filter params accepted by listTitlesHandler from the query string, and validates
+// them. title defaults to a full text search and director to an exact match, which were the only modes before
+// title_match and director_match were added.
+func (app *application) readTitleFilters(queryString url.Values, v *validator.Validator) data.TitleFilters {
+	filters := data.TitleFilters{
+		TitleType:     app.readString(queryString, "title_type", ""),
+		Title:         app.readString(queryString, "title", ""),
+		TitleMatch:    app.readString(queryString, "title_match", data.MatchFTS),
+		Director:      app.readString(queryString, "director", ""),
+		DirectorMatch: app.readString(queryString, "director_match", data.MatchExact),
+		Country:       app.readString(queryString, "country", ""),
+	}
+	data.ValidateTitleFilters(v, filters)
+	return filters
+}
+
+// readFieldset parses the comma-separated fields param from the query string, or returns an empty Fieldset
+// (every field) if it isn't given. Unknown or repeated fields are recorded in the Validator instance.
+func (app *application) readFieldset(queryString url.Values, v *validator.Validator) data.Fieldset {
+	fields := data.Fieldset{}
+	for _, field := range app.readCSV(queryString, "fields", []string{}) {
+		fields = append(fields, strings.TrimSpace(field))
+	}
+	data.ValidateFieldset(v, fields)
+	return fields
+}
+
+// readIDs parses a comma-separated list of up to max ids from the query string, or returns an empty slice if
+// no matching key could be found. If there are more than max ids, or an id isn't a positive integer, or is
+// listed more than once, an error message is recorded in the Validator instance. A list that's too long is
+// rejected without parsing the rest of it.
+func (app *application) readIDs(queryString url.Values, key string, max int, v *validator.Validator) []int64 {
+	ids := []int64{}
+	csv := queryString.Get(key)
+	if csv == "" {
+		return ids
+	}
+
+	// split off at most max+1 ids. If the last one is there, the list is too long
+	list := strings.SplitN(csv, ",", max+1)
+	if len(list) > max {
+		v.AddError(key, fmt.Sprintf("must not contain more than %d ids", max))
+		return ids
+	}
+
+	seen := make(map[int64]bool)
+	for _, id := range list {
+		idInt, err := strconv.ParseInt(strings.TrimSpace(id), 10, 64)
+		if err != nil || idInt < 1 {
+			v.AddError(key, "must only contain positive integer ids")
+			return ids
+		}
+		v.Check(!seen[idInt], key, "must not contain duplicate values")
+		seen[idInt] = true
+		ids = append(ids, idInt)
+	}
+	return ids
+}
+
+// background runs fn in a goroutine that's tracked by app.wg, so the server waits for it to return before
+// shutting down. A panic in fn is logged instead of crashing the server.
+func (app *application) background(fn func()) {
+	app.wg.Add(1)
+
+	go func() {
+		defer app.wg.Done()
+
+		defer func() {
+			if err := recover(); err != nil {
+				app.logger.Println(fmt.Errorf("%s", err))
+			}
+		}()
+
+		fn()
+	}()
+}
+
+// newSeed returns a random seed for GET /v1/titles/random, for clients that don't send one.
+func (app *application) newSeed() int64 {
+	app.randomMu.Lock()
+	defer app.randomMu.Unlock()
+
+	return app.random.Int63n(1_000_000_000)
+}
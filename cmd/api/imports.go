@@ -0,0 +1,60 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"danielmatsuda15.rest/internal/kaggle"
+)
+
+// maxImportBytes limits the size of an uploaded CSV. The full dataset is about 3MB.
+const maxImportBytes = 50 << 20
+
+// createImportHandler handles POST requests to the "/v1/imports" endpoint. Accepts the Netflix dataset in its
+// raw Kaggle CSV format, either as the request body (Content-Type: text/csv) or as the "file" field of a
+// multipart form. New, valid titles are streamed into the titles table in a single transaction. Sends a report
+// of the number of inserted rows, and the skipped (duplicate show_id) and rejected (invalid) rows.
+func (app *application) createImportHandler(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportBytes)
+
+	src, err := app.readUpload(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	defer src.Close()
+
+	report, err := kaggle.Import(r.Context(), src, app.models.Titles)
+	if err != nil {
+		switch {
+		case errors.Is(err, kaggle.ErrInvalidCSV):
+			app.badRequestResponse(w, r, err)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"report": report}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readUpload returns the uploaded file from a multipart form's "file" field, or the request body for any
+// other Content-Type.
+func (app *application) readUpload(r *http.Request) (io.ReadCloser, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if !strings.HasPrefix(mediaType, "multipart/") {
+		return r.Body, nil
+	}
+
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		return nil, errors.New("multipart form must contain a file field")
+	}
+	return file, nil
+}
@@ -0,0 +1,392 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"danielmatsuda15.rest/internal/data"
+	"danielmatsuda15.rest/internal/kaggle"
+	"danielmatsuda15.rest/internal/validator"
+)
+
+const (
+	// jobPollInterval is how often an idle worker checks the jobs table for new jobs. Jobs created by this
+	// server wake a worker straight away, so polling only matters for jobs that were requeued.
+	jobPollInterval = 5 * time.Second
+	// jobProgressInterval limits how often a running job writes its progress to the jobs table.
+	jobProgressInterval = time.Second
+	// jobLease is how long a claimed job stays leased to its worker without being renewed. The worker renews
+	// it every jobLeaseRenewInterval while the job runs, so it only expires if the worker's server goes away,
+	// and then the job is requeued by the next idle worker on any server.
+	jobLease              = time.Minute
+	jobLeaseRenewInterval = 20 * time.Second
+)
+
+// createImportJobHandler handles POST requests to the "/v1/jobs/imports" endpoint. Accepts the same CSV
+// upload as POST /v1/imports, but queues the import to be run in the background, for uploads that would take
+// longer than the server's write timeout. Sends a 202 Accepted response with the queued job.
+func (app *application) createImportJobHandler(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportBytes)
+
+	src, err := app.readUpload(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	defer src.Close()
+
+	input, err := io.ReadAll(src)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	// check the header now, so a file that isn't the dataset is rejected before it's queued
+	_, err = kaggle.NewReader(bytes.NewReader(input))
+	if err != nil {
+		app.badRequestResponse(w, r, fmt.Errorf("%w: %v", kaggle.ErrInvalidCSV, err))
+		return
+	}
+
+	app.createJob(w, r, &data.Job{Kind: data.JobImport, Input: input})
+}
+
+// createExportJobHandler handles POST requests to the "/v1/jobs/exports" endpoint. Queues an export of the
+// titles matching the same filter params as GET /v1/titles to a CSV file, which can be downloaded from the
+// job's result_location once it has succeeded. Sends a 202 Accepted response with the queued job.
+func (app *application) createExportJobHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	filters := app.readTitleFilters(r.URL.Query(), v)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	params, err := json.Marshal(filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.createJob(w, r, &data.Job{Kind: data.JobExport, Params: params})
+}
+
+// createJob queues job, wakes a worker to run it, and sends a 202 Accepted response with a Location header
+// where the job's status can be checked.
+func (app *application) createJob(w http.ResponseWriter, r *http.Request, job *data.Job) {
+	err := app.models.Jobs.Insert(r.Context(), job)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// wake an idle worker, if there is one. Otherwise the job is claimed when a worker is next free
+	select {
+	case app.jobsQueued <- struct{}{}:
+	default:
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/jobs/%d", job.ID))
+
+	err = app.writeResponse(w, r, http.StatusAccepted, envelope{"job": job}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// showJobHandler handles GET requests to the "/v1/jobs/:id" endpoint. Sends the job's status and progress,
+// along with an import's report or an export's result_location once it has finished.
+func (app *application) showJobHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	job, err := app.models.Jobs.Get(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"job": job}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// showJobResultHandler handles GET requests to the "/v1/jobs/:id/result" endpoint. Sends the CSV file
+// written by a succeeded export job.
+func (app *application) showJobResultHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	output, err := app.models.Jobs.GetOutput(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="titles-%d.csv"`, id))
+	w.Header().Set("Content-Length", strconv.Itoa(len(output)))
+	w.Write(output)
+}
+
+// startJobWorkers starts n background workers, which claim and run queued jobs until app.shutdown is closed.
+// Each worker is identified by this server's hostname and process id, so several servers can share the jobs
+// table. Jobs whose lease expired, e.g. because a server crashed, are requeued first.
+func (app *application) startJobWorkers(n int) error {
+	// jobs outlive the request that queued them, and a running job is finished when the server shuts down,
+	// so the workers' queries aren't tied to a request's context, and their own context is never canceled
+	ctx := context.Background()
+
+	err := app.requeueJobs(ctx)
+	if err != nil {
+		return err
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i < n; i++ {
+		workerID := fmt.Sprintf("%s:%d/%d", hostname, os.Getpid(), i+1)
+		app.background(func() {
+			app.jobWorker(ctx, workerID)
+		})
+	}
+	return nil
+}
+
+// requeueJobs puts the jobs whose lease has expired back in the queue.
+func (app *application) requeueJobs(ctx context.Context) error {
+	requeued, err := app.models.Jobs.Requeue(ctx)
+	if err != nil {
+		return err
+	}
+	if requeued > 0 {
+		app.logger.Printf("requeued %d interrupted jobs", requeued)
+	}
+	return nil
+}
+
+// jobWorker runs queued jobs one at a time, leased to workerID. When the queue is empty, it requeues any
+// interrupted jobs and waits for a new job to be created, or for the poll interval to pass. A job that's
+// running when the server shuts down is finished first.
+func (app *application) jobWorker(ctx context.Context, workerID string) {
+	for {
+		select {
+		case <-app.shutdown:
+			return
+		default:
+		}
+
+		job, err := app.models.Jobs.Claim(ctx, workerID, jobLease)
+		if err != nil {
+			if !errors.Is(err, data.ErrRecordNotFound) {
+				app.logger.Println(err)
+			} else if err := app.requeueJobs(ctx); err != nil {
+				app.logger.Println(err)
+			}
+			select {
+			case <-app.shutdown:
+				return
+			case <-app.jobsQueued:
+			case <-time.After(jobPollInterval):
+			}
+			continue
+		}
+
+		app.runJob(ctx, job)
+	}
+}
+
+// runJob runs a claimed job and records its outcome, renewing its lease until then. A panic while running
+// the job fails the job, instead of stopping the worker.
+func (app *application) runJob(ctx context.Context, job *data.Job) {
+	done := make(chan struct{})
+	defer close(done)
+	go app.renewJobLease(ctx, job, done)
+
+	defer func() {
+		if err := recover(); err != nil {
+			app.finishJob(ctx, job, fmt.Errorf("%s", err))
+		}
+	}()
+
+	var err error
+	switch job.Kind {
+	case data.JobImport:
+		err = app.runImportJob(ctx, job)
+	case data.JobExport:
+		err = app.runExportJob(ctx, job)
+	default:
+		err = fmt.Errorf("unknown job kind %q", job.Kind)
+	}
+	app.finishJob(ctx, job, err)
+}
+
+// finishJob marks job as succeeded, or as failed with err.
+func (app *application) finishJob(ctx context.Context, job *data.Job, err error) {
+	if err != nil {
+		app.logger.Printf("job %d failed: %v", job.ID, err)
+		job.Status = data.JobFailed
+		job.Error = err.Error()
+		job.Result, job.Output, job.ResultLocation = nil, nil, ""
+	} else {
+		job.Status = data.JobSucceeded
+		job.Progress = 100
+	}
+
+	err = app.models.Jobs.Finish(ctx, job)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			err = fmt.Errorf("job %d: lease expired before it finished, so it was requeued", job.ID)
+		}
+		app.logger.Println(err)
+	}
+}
+
+// renewJobLease renews the lease on job every jobLeaseRenewInterval, until done is closed.
+func (app *application) renewJobLease(ctx context.Context, job *data.Job, done <-chan struct{}) {
+	ticker := time.NewTicker(jobLeaseRenewInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			err := app.models.Jobs.RenewLease(ctx, job, jobLease)
+			if err != nil {
+				if errors.Is(err, data.ErrRecordNotFound) {
+					err = fmt.Errorf("job %d: lost its lease", job.ID)
+				}
+				app.logger.Println(err)
+			}
+		}
+	}
+}
+
+// jobProgress returns a func that records job's progress, at most once per jobProgressInterval. Progress is
+// capped at 99% until the job has finished.
+func (app *application) jobProgress(ctx context.Context, job *data.Job) func(progress int) {
+	var last time.Time
+	return func(progress int) {
+		if progress > 99 {
+			progress = 99
+		}
+		if progress <= job.Progress || time.Since(last) < jobProgressInterval {
+			return
+		}
+		job.Progress = progress
+		last = time.Now()
+
+		err := app.models.Jobs.UpdateProgress(ctx, job, progress)
+		if err != nil {
+			app.logger.Println(err)
+		}
+	}
+}
+
+// runImportJob imports the job's uploaded CSV. Its progress is the share of the CSV that has been read.
+func (app *application) runImportJob(ctx context.Context, job *data.Job) error {
+	src := &progressReader{r: bytes.NewReader(job.Input), size: len(job.Input), progress: app.jobProgress(ctx, job)}
+
+	report, err := kaggle.Import(ctx, src, app.models.Titles)
+	if err != nil {
+		return err
+	}
+
+	job.Result, err = json.Marshal(report)
+	return err
+}
+
+// runExportJob writes the titles matching the job's filters to a CSV file, which is stored as the job's
+// output. Its progress is the share of the titles that have been written.
+func (app *application) runExportJob(ctx context.Context, job *data.Job) error {
+	var filters data.TitleFilters
+	err := json.Unmarshal(job.Params, &filters)
+	if err != nil {
+		return err
+	}
+
+	titles, err := app.models.Titles.GetAll(ctx, filters, nil)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	err = exportTitlesCSV(&buf, titles, app.jobProgress(ctx, job))
+	if err != nil {
+		return err
+	}
+
+	job.Output = buf.Bytes()
+	job.ResultLocation = fmt.Sprintf("/v1/jobs/%d/result", job.ID)
+	job.Result, err = json.Marshal(map[string]int{"titles": len(titles)})
+	return err
+}
+
+// exportTitlesCSV writes titles to w as CSV, with a header row. progress is called with the percentage of
+// the titles written so far.
+func exportTitlesCSV(w io.Writer, titles []*data.Title, progress func(int)) error {
+	cw := csv.NewWriter(w)
+
+	err := cw.Write(data.TitleFields)
+	if err != nil {
+		return err
+	}
+	for i, title := range titles {
+		err := cw.Write(titleCSVRecord(title, nil))
+		if err != nil {
+			return err
+		}
+		progress((i + 1) * 100 / len(titles))
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// progressReader reports the percentage of its underlying reader that has been read.
+type progressReader struct {
+	r        io.Reader
+	size     int
+	read     int
+	progress func(int)
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.read += n
+	if p.size > 0 {
+		p.progress(p.read * 100 / p.size)
+	}
+	return n, err
+}
@@ -5,14 +5,15 @@ import (
 	"database/sql"
 	"expvar"
 	"flag"
-	"fmt"
 	"log"
-	"net/http"
+	"math/rand"
 	"os"
 	"runtime"
+	"sync"
 	"time"
 
 	"danielmatsuda15.rest/internal/data"
+	"danielmatsuda15.rest/internal/search"
 	_ "github.com/lib/pq"
 )
 
@@ -22,21 +23,42 @@ type config struct {
 	port int
 	env  string
 	db   struct {
+		driver       string
 		dsn          string
 		maxOpenConns int
 		maxIdleConns int
 		maxIdleTime  string
+		queryTimeout time.Duration
 	}
 	limiter struct {
 		rps   float64
 		burst int
 	}
+	search struct {
+		backend string
+	}
+	similar data.SimilarityWeights
+	jobs    struct {
+		workers int
+	}
 }
 
 type application struct {
 	config config
 	logger *log.Logger
 	models data.Models
+	search *search.Index // nil unless -search-backend=embedded
+
+	// random generates the seeds for GET /v1/titles/random. A rand.Rand isn't safe for concurrent use, so
+	// it's guarded by randomMu
+	randomMu sync.Mutex
+	random   *rand.Rand
+
+	// background job workers. jobsQueued wakes an idle worker when a job is created, and closing shutdown
+	// stops the workers once their current jobs have finished
+	wg         sync.WaitGroup
+	jobsQueued chan struct{}
+	shutdown   chan struct{}
 }
 
 func main() {
@@ -46,31 +68,101 @@ func main() {
 	flag.IntVar(&cfg.port, "port", 4000, "API server port")
 	flag.StringVar(&cfg.env, "env", "development", "Environment (development|staging|production)")
 
+	// where the titles are stored. By default, a sqlite3:// or file: DSN selects SQLite, and any other DSN
+	// PostgreSQL. memory is a demo mode that starts out empty and doesn't need a database
+	flag.StringVar(&cfg.db.driver, "db-driver", "", "Title storage (postgres|sqlite|memory), chosen by the -db-dsn scheme if not set")
+
 	// NOTE: for local testing, the database DSN is automatically provided in the Makefile via environment variable
-	flag.StringVar(&cfg.db.dsn, "db-dsn", "", "PostgreSQL DSN")
+	flag.StringVar(&cfg.db.dsn, "db-dsn", "", "PostgreSQL DSN, or sqlite3://path for SQLite")
 
 	// get connection pool flags
 	flag.IntVar(&cfg.db.maxOpenConns, "db-max-open-conns", 25, "PostgreSQL max open connections")
 	flag.IntVar(&cfg.db.maxIdleConns, "db-max-idle-conns", 25, "PostgreSQL max idle connections")
 	flag.StringVar(&cfg.db.maxIdleTime, "db-max-idle-time", "15m", "PostgreSQL max connection idle time")
 
+	// upper bound on each query. A query is also canceled if the client that made the request goes away
+	flag.DurationVar(&cfg.db.queryTimeout, "db-query-timeout", data.DefaultQueryTimeout, "PostgreSQL query timeout")
+
 	// rate limiter settings. Rate limiting is always enabled
 	flag.Float64Var(&cfg.limiter.rps, "limiter-rps", 2, "Rate limiter max requests per second")
 	flag.IntVar(&cfg.limiter.burst, "limiter-burst", 4, "Rate limiter max burst")
 
+	// where listTitlesHandler searches: PostgreSQL, or an in-process index that's rebuilt at startup
+	flag.StringVar(&cfg.search.backend, "search-backend", "postgres", "Title search backend (postgres|embedded)")
+
+	// weights of each kind of likeness in GET /v1/titles/:id/similar
+	flag.Float64Var(&cfg.similar.Director, "similar-director-weight", 3, "Similar titles weight of a shared director")
+	flag.Float64Var(&cfg.similar.Country, "similar-country-weight", 1, "Similar titles weight of shared countries")
+	flag.Float64Var(&cfg.similar.Year, "similar-year-weight", 1, "Similar titles weight of a nearby release year")
+	flag.Float64Var(&cfg.similar.TitleType, "similar-type-weight", 1, "Similar titles weight of the same title type")
+	flag.Float64Var(&cfg.similar.Text, "similar-text-weight", 2, "Similar titles weight of title/description text similarity")
+
+	// number of background workers running import and export jobs
+	flag.IntVar(&cfg.jobs.workers, "job-workers", 2, "Number of background job workers")
+
 	flag.Parse()
 
 	// init a logger that writes to stdout, prefixed with current date and time
 	logger := log.New(os.Stdout, "", log.Ldate|log.Ltime)
 
-	// create a connection pool
-	db, err := openDB(cfg)
-	if err != nil {
-		logger.Fatal(err)
+	if cfg.db.driver == "" {
+		cfg.db.driver = "postgres"
+		if data.IsSQLiteDSN(cfg.db.dsn) {
+			cfg.db.driver = "sqlite"
+		}
+	}
+	if cfg.db.driver != "postgres" && cfg.db.driver != "sqlite" && cfg.db.driver != "memory" {
+		logger.Fatalf("invalid -db-driver %q: must be postgres, sqlite or memory", cfg.db.driver)
+	}
+	if cfg.search.backend != "postgres" && cfg.search.backend != "embedded" {
+		logger.Fatalf("invalid -search-backend %q: must be postgres or embedded", cfg.search.backend)
 	}
+	if cfg.db.queryTimeout <= 0 {
+		logger.Fatalf("invalid -db-query-timeout %s: must be greater than zero", cfg.db.queryTimeout)
+	}
+	if cfg.jobs.workers < 1 {
+		logger.Fatalf("invalid -job-workers %d: must be at least 1", cfg.jobs.workers)
+	}
+	// a negative weight would rank titles lower for being alike
+	for name, weight := range map[string]float64{
+		"director": cfg.similar.Director,
+		"country":  cfg.similar.Country,
+		"year":     cfg.similar.Year,
+		"type":     cfg.similar.TitleType,
+		"text":     cfg.similar.Text,
+	} {
+		if weight < 0 {
+			logger.Fatalf("invalid -similar-%s-weight %g: must not be negative", name, weight)
+		}
+	}
+
+	var models data.Models
+	switch cfg.db.driver {
+	case "memory":
+		models = data.NewMemoryModels()
+		logger.Printf("titles are kept in memory, and will be lost when the server stops")
+	default:
+		// create a connection pool
+		db, err := openDB(cfg)
+		if err != nil {
+			logger.Fatal(err)
+		}
 
-	defer db.Close()
-	logger.Printf("db connection pool established")
+		defer db.Close()
+		logger.Printf("db connection pool established")
+
+		// db connection pool info, in the expvar handler
+		expvar.Publish("database", expvar.Func(func() interface{} {
+			return db.Stats()
+		}))
+
+		// create a new Model for the db connection pool
+		if cfg.db.driver == "sqlite" {
+			models = data.NewSQLiteModels(db, cfg.db.queryTimeout)
+		} else {
+			models = data.NewModels(db, cfg.db.queryTimeout)
+		}
+	}
 
 	// publish variables in the expvar handler. View them and other metrics at /debug/vars
 	expvar.NewString("version").Set(version)
@@ -78,10 +170,6 @@ func main() {
 	expvar.Publish("goroutines", expvar.Func(func() interface{} {
 		return runtime.NumGoroutine()
 	}))
-	// db connection pool info
-	expvar.Publish("database", expvar.Func(func() interface{} {
-		return db.Stats()
-	}))
 	// current timestamp
 	expvar.Publish("timestamp", expvar.Func(func() interface{} {
 		return time.Now().Unix()
@@ -91,27 +179,58 @@ func main() {
 	app := &application{
 		config: cfg,
 		logger: logger,
-		models: data.NewModels(db), // create a new Model for the db connection pool
+		models: models,
+
+		random: rand.New(rand.NewSource(time.Now().UnixNano())),
+
+		jobsQueued: make(chan struct{}, 1),
+		shutdown:   make(chan struct{}),
 	}
 
-	// declare http server
-	srv := &http.Server{
-		Addr:         fmt.Sprintf(":%d", cfg.port),
-		Handler:      app.routes(),
-		IdleTimeout:  time.Minute,
-		ReadTimeout:  10 * time.Second,
-		WriteTimeout: 30 * time.Second,
+	// fail now, rather than on every read, if the titles table doesn't have the columns the queries select
+	err := app.models.Titles.CheckSchema(context.Background())
+	if err != nil {
+		logger.Fatal(err)
 	}
 
-	logger.Printf("starting %s server on %s", cfg.env, srv.Addr)
-	err = srv.ListenAndServe()
-	logger.Fatal(err)
+	// build the embedded search index from the titles table. The index observes the TitleRepository
+	// before it's built, so no writes are missed
+	if cfg.search.backend == "embedded" {
+		app.search = search.New()
+		app.models.Titles.Observe(app.search)
+
+		err = app.rebuildSearchIndex(context.Background())
+		if err != nil {
+			logger.Fatal(err)
+		}
+		logger.Printf("embedded search index built with %d titles", app.search.Len())
+	}
+
+	// jobs are stored in PostgreSQL, so there are no workers with the other drivers
+	if app.models.Jobs.Available() {
+		err = app.startJobWorkers(cfg.jobs.workers)
+		if err != nil {
+			logger.Fatal(err)
+		}
+	}
+
+	// start the http server, which blocks until the server has shut down
+	err = app.serve()
+	if err != nil {
+		logger.Fatal(err)
+	}
 }
 
-// openDB returns a sql.DB connection pool
+// openDB returns a sql.DB connection pool for the PostgreSQL or SQLite database
 func openDB(cfg config) (*sql.DB, error) {
 	// use DSN to create empty conn pool
-	db, err := sql.Open("postgres", cfg.db.dsn)
+	var db *sql.DB
+	var err error
+	if cfg.db.driver == "sqlite" {
+		db, err = data.OpenSQLite(cfg.db.dsn)
+	} else {
+		db, err = sql.Open("postgres", cfg.db.dsn)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"net/http"
+
+	"danielmatsuda15.rest/internal/data"
+)
+
+// showMetaHandler handles GET requests to the "/v1/meta" endpoint. Sends a description of every param that
+// filters the titles, with the operators it supports and where to find its allowed values.
+func (app *application) showMetaHandler(w http.ResponseWriter, r *http.Request) {
+	env := envelope{
+		"filters":     data.FilterFields,
+		"facets":      data.FacetFields,
+		"match_modes": data.MatchModes,
+	}
+
+	err := app.writeResponse(w, r, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listTitleTypesHandler handles GET requests to the "/v1/meta/title-types" endpoint. Sends each title_type
+// in the catalog with its number of titles.
+func (app *application) listTitleTypesHandler(w http.ResponseWriter, r *http.Request) {
+	titleTypes, err := app.models.Meta.TitleTypes(r.Context())
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"title_types": titleTypes}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listCountriesHandler handles GET requests to the "/v1/meta/countries" endpoint. Sends each country in the
+// catalog, spelled the way the data spells it, with its number of titles.
+func (app *application) listCountriesHandler(w http.ResponseWriter, r *http.Request) {
+	countries, err := app.models.Meta.Countries(r.Context())
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"countries": countries}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listRatingsHandler handles GET requests to the "/v1/meta/ratings" endpoint. Sends each maturity rating in
+// the catalog with its number of titles.
+func (app *application) listRatingsHandler(w http.ResponseWriter, r *http.Request) {
+	ratings, err := app.models.Meta.Ratings(r.Context())
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"ratings": ratings}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -32,6 +32,31 @@ func (app *application) recoverPanic(next http.Handler) http.Handler {
 	})
 }
 
+// requireJobs sends a 501 Not Implemented response instead of calling next, if background jobs can't be
+// stored, e.g. when running with -db-driver=memory.
+func (app *application) requireJobs(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !app.models.Jobs.Available() {
+			app.jobsUnavailableResponse(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	}
+}
+
+// negotiate sends a 406 Not Acceptable response if the request's Accept header doesn't list any supported
+// media type, before the handler has a chance to act on the request.
+func (app *application) negotiate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, ok := negotiateFormat(r.Header.Get("Accept"))
+		if !ok {
+			app.notAcceptableResponse(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
 // rateLimit applies the rate limit rules, found in app.config.limiter, to the router.
 func (app *application) rateLimit(next http.Handler) http.Handler {
 	limiter := rate.NewLimiter(rate.Limit(app.config.limiter.rps), app.config.limiter.burst)
@@ -20,13 +20,51 @@ func (app *application) routes() http.Handler {
 
 	router.HandlerFunc(http.MethodGet, "/v1/titles", app.listTitlesHandler)
 	router.HandlerFunc(http.MethodPost, "/v1/titles", app.createTitleHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/titles/bulk", app.bulkCreateTitlesHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/titles/bulk-update", app.bulkUpdateTitlesHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/titles/bulk-delete", app.bulkDeleteTitlesHandler)
 
-	router.HandlerFunc(http.MethodGet, "/v1/titles/:id", app.showTitleHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/titles/:id", app.titleGetHandler)
 	router.HandlerFunc(http.MethodPut, "/v1/titles/:id", app.updateTitleHandler)
 	router.HandlerFunc(http.MethodDelete, "/v1/titles/:id", app.deleteTitleHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/titles/:id/similar", app.listSimilarTitlesHandler)
+
+	router.HandlerFunc(http.MethodPost, "/v1/imports", app.createImportHandler)
+
+	router.HandlerFunc(http.MethodPost, "/v1/jobs/imports", app.requireJobs(app.createImportJobHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/jobs/exports", app.requireJobs(app.createExportJobHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/jobs/:id", app.requireJobs(app.showJobHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/jobs/:id/result", app.requireJobs(app.showJobResultHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/directors", app.listDirectorsHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/directors/:name/titles", app.showDirectorTitlesHandler)
+
+	router.HandlerFunc(http.MethodGet, "/v1/meta", app.showMetaHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/meta/title-types", app.listTitleTypesHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/meta/countries", app.listCountriesHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/meta/ratings", app.listRatingsHandler)
+
+	router.HandlerFunc(http.MethodGet, "/v1/stats", app.showStatsHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/stats/timeline", app.showTimelineHandler)
+
+	router.HandlerFunc(http.MethodPost, "/v1/caches/reload", app.reloadCachesHandler)
 
 	router.Handler(http.MethodGet, "/debug/vars", expvar.Handler())
 
 	// apply middleware logic before any actual routing occurs
-	return app.metrics(app.recoverPanic(app.rateLimit(router)))
+	return app.metrics(app.recoverPanic(app.rateLimit(app.negotiate(router))))
+}
+
+// titleGetHandler handles GET requests to the "/v1/titles/:id" route. httprouter doesn't allow static paths
+// like "/v1/titles/random" and "/v1/titles/compare" alongside the :id wildcard, so they're dispatched from
+// here instead.
+func (app *application) titleGetHandler(w http.ResponseWriter, r *http.Request) {
+	switch httprouter.ParamsFromContext(r.Context()).ByName("id") {
+	case "random":
+		app.randomTitlesHandler(w, r)
+	case "compare":
+		app.compareTitlesHandler(w, r)
+	default:
+		app.showTitleHandler(w, r)
+	}
 }
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// serve starts the HTTP server, and shuts it down gracefully on a SIGINT or SIGTERM signal. In-flight requests
+// get up to 5 seconds to complete, then the background job workers finish their current jobs before serve
+// returns, whether or not the requests completed in time.
+func (app *application) serve() error {
+	srv := &http.Server{
+		Addr:         fmt.Sprintf(":%d", app.config.port),
+		Handler:      app.routes(),
+		IdleTimeout:  time.Minute,
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: 30 * time.Second,
+	}
+
+	shutdownError := make(chan error)
+
+	go func() {
+		// block until a shutdown signal is received
+		quit := make(chan os.Signal, 1)
+		signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+		s := <-quit
+
+		app.logger.Printf("shutting down server, signal: %s", s)
+
+		// stop accepting requests, and wait for in-flight requests to complete
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		err := srv.Shutdown(ctx)
+
+		// stop the job workers from claiming new jobs, and wait for their current jobs to finish. This happens
+		// even if some requests didn't complete in time, so a job isn't cut off halfway through
+		app.logger.Printf("completing background jobs")
+		close(app.shutdown)
+		app.wg.Wait()
+		shutdownError <- err
+	}()
+
+	app.logger.Printf("starting %s server on %s", app.config.env, srv.Addr)
+
+	// Shutdown() makes ListenAndServe() return http.ErrServerClosed straight away, so only other errors are
+	// returned here
+	err := srv.ListenAndServe()
+	if !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	err = <-shutdownError
+	if err != nil {
+		return err
+	}
+
+	app.logger.Printf("stopped server on %s", srv.Addr)
+	return nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"net/http"
+
+	"danielmatsuda15.rest/internal/data"
+	"danielmatsuda15.rest/internal/validator"
+)
+
+// showStatsHandler handles GET requests to the "/v1/stats" endpoint. Sends aggregate counts over the titles
+// that match the same filters as listTitlesHandler: totals by title_type, the top countries and directors,
+// and the number of titles per release year. The limit param sets how many top countries and directors are sent.
+func (app *application) showStatsHandler(w http.ResponseWriter, r *http.Request) {
+	queryString := r.URL.Query()
+
+	v := validator.New()
+	filters := app.readTitleFilters(queryString, v)
+	limit := app.readInt(queryString, "limit", 10, v)
+
+	v.Check(limit >= 1, "limit", "must be greater than zero")
+	v.Check(limit <= 100, "limit", "must be a maximum of 100")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// results are cached by the data layer until the next write to the titles table
+	stats, err := app.models.Stats.Get(r.Context(), filters, limit)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"stats": stats}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// showTimelineHandler handles GET requests to the "/v1/stats/timeline" endpoint. Sends the number of titles
+// released per year (by=release_year) or added to Netflix per month (by=added_month) that match the same
+// filters as listTitlesHandler. group=title_type breaks each period's count down by title type, and the
+// optional from and to params bound the periods.
+func (app *application) showTimelineHandler(w http.ResponseWriter, r *http.Request) {
+	queryString := r.URL.Query()
+
+	v := validator.New()
+	filters := app.readTitleFilters(queryString, v)
+	q := data.TimelineQuery{
+		By:    app.readString(queryString, "by", data.ByReleaseYear),
+		Group: app.readString(queryString, "group", ""),
+		From:  app.readString(queryString, "from", ""),
+		To:    app.readString(queryString, "to", ""),
+	}
+
+	if data.ValidateTimelineQuery(v, q); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	timeline, err := app.models.Stats.Timeline(r.Context(), filters, q)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"timeline": timeline}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -3,12 +3,27 @@ package main
 import (
 	"errors"
 	"fmt"
+	"mime"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"danielmatsuda15.rest/internal/data"
 	"danielmatsuda15.rest/internal/validator"
 )
 
+// maxSuggestions is the most "did you mean" titles listTitlesHandler returns for a title search with no results.
+const maxSuggestions = 5
+
+// maxBatchIDs is the most ids listTitlesByIDHandler fetches in one request.
+const maxBatchIDs = 100
+
+// maxBulkTitles is the most titles bulkCreateTitlesHandler accepts in one request.
+const maxBulkTitles = 1000
+
+// maxFacetValues is the most values listTitlesHandler returns per facet, most common first.
+const maxFacetValues = 20
+
 // createTitleHandler handles POST requests to the "/v1/titles" endpoint.
 // Currently, only allows the client to update one item at a time.
 func (app *application) createTitleHandler(w http.ResponseWriter, r *http.Request) {
@@ -22,7 +37,7 @@ func (app *application) createTitleHandler(w http.ResponseWriter, r *http.Reques
 	}
 	// init a new json.Decoder instance, which reads from the request body
 	// and uses the Decode() method to dump the relevant key/value pairs into input using pointers
-	err := app.readJSON(w, r, &input)
+	err := app.readInput(w, r, &input)
 	if err != nil {
 		app.badRequestResponse(w, r, err)
 		return
@@ -45,7 +60,7 @@ func (app *application) createTitleHandler(w http.ResponseWriter, r *http.Reques
 	}
 
 	// insert the new title into the db, and write the new item's id to title.ID
-	err = app.models.Titles.Insert(title)
+	err = app.models.Titles.Insert(r.Context(), title)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
@@ -55,7 +70,7 @@ func (app *application) createTitleHandler(w http.ResponseWriter, r *http.Reques
 	headers := make(http.Header)
 	headers.Set("Location", fmt.Sprintf("/v1/titles/%d", title.ID))
 	// write the JSON response
-	err = app.writeJSON(w, http.StatusCreated, envelope{"title": title}, headers)
+	err = app.writeResponse(w, r, http.StatusCreated, envelope{"title": title}, headers)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -70,8 +85,16 @@ func (app *application) showTitleHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	// the fields param selects a subset of the title's fields
+	v := validator.New()
+	fields := app.readFieldset(r.URL.Query(), v)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
 	// send SQL query for given id. If a data.ErrRecordNotFound error is returned, send 404 response to client
-	title, err := app.models.Titles.Get(id)
+	title, err := app.models.Titles.Get(r.Context(), id, fields)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -82,7 +105,7 @@ func (app *application) showTitleHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 	// entry found. Write its data as JSON response to client
-	err = app.writeJSON(w, http.StatusOK, envelope{"title": title}, nil)
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"title": fields.Project(title)}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -98,7 +121,7 @@ func (app *application) updateTitleHandler(w http.ResponseWriter, r *http.Reques
 	}
 
 	// call GET on the id to update, to make sure it exists
-	title, err := app.models.Titles.Get(id)
+	title, err := app.models.Titles.Get(r.Context(), id, nil)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -120,7 +143,7 @@ func (app *application) updateTitleHandler(w http.ResponseWriter, r *http.Reques
 	}
 
 	// read the JSON response data from the Get() call into the input struct
-	err = app.readJSON(w, r, &input)
+	err = app.readInput(w, r, &input)
 	if err != nil {
 		app.badRequestResponse(w, r, err)
 		return
@@ -141,14 +164,19 @@ func (app *application) updateTitleHandler(w http.ResponseWriter, r *http.Reques
 	}
 
 	// finally, use the request values from title to update the entry
-	err = app.models.Titles.Update(title)
+	err = app.models.Titles.Update(r.Context(), title)
 	if err != nil {
-		app.serverErrorResponse(w, r, err)
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
 		return
 	}
 
 	// Write the updated data as a JSON response to client
-	err = app.writeJSON(w, http.StatusOK, envelope{"title": title}, nil)
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"title": title}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -164,7 +192,7 @@ func (app *application) deleteTitleHandler(w http.ResponseWriter, r *http.Reques
 	}
 
 	// delete the entry with the given id, or send error to client if entry not found
-	err = app.models.Titles.Delete(id)
+	err = app.models.Titles.Delete(r.Context(), id)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -176,7 +204,7 @@ func (app *application) deleteTitleHandler(w http.ResponseWriter, r *http.Reques
 	}
 
 	// DELETE was successful, so write a 200 OK status and message as JSON to client
-	err = app.writeJSON(w, http.StatusOK, envelope{"message": "title successfully deleted"}, nil)
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"message": "title successfully deleted"}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -185,34 +213,565 @@ func (app *application) deleteTitleHandler(w http.ResponseWriter, r *http.Reques
 // listTitlesHandler handles GET requests to the "/v1/titles" endpoint.
 // Sends a JSON response containing all titles from the titles table that match
 // the filtering criteria passed in by the client. The filters are passed in by the client as query string parameters.
+// With Accept: text/csv or format=csv, the titles are streamed as a CSV file instead, and with
+// Accept: application/x-ndjson or format=ndjson, as newline-delimited JSON.
 func (app *application) listTitlesHandler(w http.ResponseWriter, r *http.Request) {
 	// get the url.Values map of query string data
 	queryString := r.URL.Query()
 
+	// a list of ids fetches those titles instead of filtering
+	if queryString.Get("ids") != "" {
+		app.listTitlesByIDHandler(w, r)
+		return
+	}
+
 	// define an input struct to hold possible filter params
 	var input struct {
-		TitleType string
-		Title     string
-		Director  string
-		Country   string
+		data.TitleFilters
+		Facets []string
+		Fields data.Fieldset
 	}
 
 	// read the parameters into input, possibly using converted param vals, or their defaults if not provided
-	input.TitleType = app.readString(queryString, "title_type", "")
-	input.Title = app.readString(queryString, "title", "")
-	input.Director = app.readString(queryString, "director", "")
-	input.Country = app.readString(queryString, "country", "")
+	v := validator.New()
+	input.TitleFilters = app.readTitleFilters(queryString, v)
+	input.Facets = app.readCSV(queryString, "facets", []string{})
+	input.Fields = app.readFieldset(queryString, v)
+	format := app.responseFormat(r, v)
+
+	if data.ValidateFacets(v, input.Facets); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// CSV and NDJSON responses are streamed title by title, instead of being collected into one response.
+	// Spreadsheets and bulk consumers only need the titles, so facets and suggestions are left out
+	if format == "csv" || format == "ndjson" {
+		app.streamTitles(w, r, format, input.TitleFilters, input.Fields)
+		return
+	}
+
+	// run a GET request, filtering on these params. The embedded search index returns the same titles,
+	// but ranks full text search results by relevance instead of ordering them by id
+	var titles []*data.Title
+	if app.search != nil {
+		titles = app.search.Search(input.TitleFilters)
+	} else {
+		var err error
+		titles, err = app.models.Titles.GetAll(r.Context(), input.TitleFilters, input.Fields)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	env := envelope{"titles": projectTitles(titles, input.Fields)}
 
-	// run a GET request, filtering on these params
-	filterParams := []interface{}{input.Title, input.Country, input.TitleType, input.Director}
-	titles, err := app.models.Titles.GetAll(filterParams)
+	// count the values of each requested facet among all the matching titles
+	if len(input.Facets) > 0 {
+		var facets map[string][]data.FacetCount
+		if app.search != nil {
+			facets = app.search.Facets(input.TitleFilters, input.Facets, maxFacetValues)
+		} else {
+			var err error
+			facets, err = app.models.Titles.Facets(r.Context(), input.TitleFilters, input.Facets, maxFacetValues)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+		}
+		env["facets"] = facets
+	}
+
+	// a title search with no results is probably misspelled, so suggest the closest titles in the catalog
+	if input.Title != "" && len(titles) == 0 {
+		suggestions, err := app.models.Titles.Suggest(r.Context(), input.TitleFilters, maxSuggestions)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		env["suggestions"] = suggestions
+	}
+
+	// return a JSON response to the client
+	err := app.writeResponse(w, r, http.StatusOK, env, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
+}
 
-	// return a JSON response to the client
-	err = app.writeJSON(w, http.StatusOK, envelope{"titles": titles}, nil)
+// titleCSVRecord returns title's selected fields as a CSV row. The header row is fields.Fields(). Text fields
+// are escaped with escapeCSVCell(), since the CSV is meant to be opened in a spreadsheet.
+func titleCSVRecord(title *data.Title, fields data.Fieldset) []string {
+	values := fields.Values(title)
+	record := make([]string, 0, len(values))
+	for _, value := range values {
+		if text, ok := value.(string); ok {
+			record = append(record, escapeCSVCell(text))
+			continue
+		}
+		record = append(record, fmt.Sprint(value))
+	}
+	return record
+}
+
+// csvFormulaPrefixes are the characters that make a spreadsheet read a cell as a formula.
+// See https://owasp.org/www-community/attacks/CSV_Injection
+const csvFormulaPrefixes = "=+-@\t\r"
+
+// escapeCSVCell prefixes value with a ' if it starts with one of csvFormulaPrefixes, so a title created
+// through the API can't run as a formula when an export is opened in a spreadsheet. The ' is hidden by the
+// spreadsheet, which shows the rest of the cell as text.
+func escapeCSVCell(value string) string {
+	if value != "" && strings.ContainsRune(csvFormulaPrefixes, rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+// projectTitles returns titles with only the selected fields, for sending to the client.
+func projectTitles(titles []*data.Title, fields data.Fieldset) []interface{} {
+	projected := make([]interface{}, 0, len(titles))
+	for _, title := range titles {
+		projected = append(projected, fields.Project(title))
+	}
+	return projected
+}
+
+// streamTitles sends the titles matching filters as a CSV file with a header row, or as NDJSON with one title
+// per line. With the postgres search backend, each title is sent as its row is scanned, so the full catalog
+// is never held in memory.
+func (app *application) streamTitles(w http.ResponseWriter, r *http.Request, format string, filters data.TitleFilters, fields data.Fieldset) {
+	each := func(fn func(*data.Title) error) error {
+		return app.models.Titles.GetAllFunc(r.Context(), filters, fields, fn)
+	}
+	if app.search != nil {
+		each = func(fn func(*data.Title) error) error {
+			for _, title := range app.search.Search(filters) {
+				err := fn(title)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	}
+
+	app.sendTitles(w, r, format, fields, each)
+}
+
+// sendTitles sends the titles passed to fn by each as a CSV file with a header row, or as NDJSON with one
+// title per line, with only the fields in fields.
+func (app *application) sendTitles(w http.ResponseWriter, r *http.Request, format string, fields data.Fieldset, each func(fn func(*data.Title) error) error) {
+	var err error
+	switch format {
+	case "csv":
+		headers := make(http.Header)
+		headers.Set("Content-Disposition", `attachment; filename="titles.csv"`)
+
+		err = app.writeCSV(w, http.StatusOK, fields.Fields(), func(write func([]string) error) error {
+			return each(func(title *data.Title) error {
+				return write(titleCSVRecord(title, fields))
+			})
+		}, headers)
+	default:
+		err = app.writeNDJSON(w, http.StatusOK, func(write func(interface{}) error) error {
+			return each(func(title *data.Title) error {
+				return write(fields.Project(title))
+			})
+		}, nil)
+	}
+	if err != nil {
+		app.streamErrorResponse(w, r, err)
+	}
+}
+
+// listSimilarTitlesHandler handles GET requests to the "/v1/titles/:id/similar" endpoint. Sends the titles
+// most like the given title, scored by a shared director, overlapping countries, a nearby release year, the
+// same title type and similar text. The weight of each is set by the -similar-*-weight flags, and the limit
+// param sets how many titles are sent.
+func (app *application) listSimilarTitlesHandler(w http.ResponseWriter, r *http.Request) {
+	// read the requested id as an int
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	v := validator.New()
+	limit := app.readInt(r.URL.Query(), "limit", 10, v)
+	v.Check(limit >= 1, "limit", "must be greater than zero")
+	v.Check(limit <= 50, "limit", "must be a maximum of 50")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// call GET on the id first, to make sure it exists
+	_, err = app.models.Titles.Get(r.Context(), id, nil)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	similar, err := app.models.Titles.Similar(r.Context(), id, app.config.similar, limit)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"titles": similar}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// randomTitlesHandler handles GET requests to the "/v1/titles/random" endpoint. Sends count titles sampled at
+// random from the titles that match the same filters as listTitlesHandler. The same seed param sends the
+// same sample, so a seed is generated and sent back if the client doesn't give one.
+func (app *application) randomTitlesHandler(w http.ResponseWriter, r *http.Request) {
+	queryString := r.URL.Query()
+
+	v := validator.New()
+	filters := app.readTitleFilters(queryString, v)
+	count := app.readInt(queryString, "count", 1, v)
+	v.Check(count >= 1, "count", "must be greater than zero")
+	v.Check(count <= 100, "count", "must be a maximum of 100")
+
+	var seed int64
+	if queryString.Get("seed") != "" {
+		var err error
+		seed, err = strconv.ParseInt(queryString.Get("seed"), 10, 64)
+		v.Check(err == nil, "seed", "must be an integer value")
+		v.Check(seed >= -data.MaxRandomSeed && seed <= data.MaxRandomSeed, "seed", fmt.Sprintf("must be between %d and %d", int64(-data.MaxRandomSeed), int64(data.MaxRandomSeed)))
+	} else {
+		seed = app.newSeed()
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	titles, err := app.models.Titles.Random(r.Context(), filters, count, seed)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"titles": titles, "seed": seed}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
 }
+
+// listTitlesByIDHandler handles GET requests to the "/v1/titles" endpoint with an ids param (e.g. ids=1,5,9).
+// Sends the titles with those ids in a single query, in the requested order, and lists the ids that don't
+// exist separately as missing_ids.
+func (app *application) listTitlesByIDHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	ids := app.readIDs(r.URL.Query(), "ids", maxBatchIDs, v)
+	fields := app.readFieldset(r.URL.Query(), v)
+	format := app.responseFormat(r, v)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	titles, err := app.models.Titles.GetMany(r.Context(), ids, fields)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// a CSV or NDJSON response only has room for the titles, like listTitlesHandler's, so missing ids are
+	// just left out
+	if format == "csv" || format == "ndjson" {
+		app.sendTitles(w, r, format, fields, func(fn func(*data.Title) error) error {
+			for _, title := range titles {
+				err := fn(title)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		return
+	}
+
+	// any requested id that wasn't returned doesn't exist
+	found := make(map[int64]bool)
+	for _, title := range titles {
+		found[title.ID] = true
+	}
+	missingIDs := []int64{}
+	for _, id := range ids {
+		if !found[id] {
+			missingIDs = append(missingIDs, id)
+		}
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"titles": projectTitles(titles, fields), "missing_ids": missingIDs}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// compareTitlesHandler handles GET requests to the "/v1/titles/compare" endpoint. Sends the titles in the ids
+// param (e.g. ids=1,2,3), a field-by-field comparison of them, and a summary of what they all share.
+func (app *application) compareTitlesHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	ids := app.readIDs(r.URL.Query(), "ids", 10, v)
+
+	v.Check(len(ids) >= 2, "ids", "must contain at least 2 ids")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// fetch every title in a single query. If any of them doesn't exist, send a 404 response
+	titles, err := app.models.Titles.GetMany(r.Context(), ids, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if len(titles) != len(ids) {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	env := envelope{
+		"titles":     titles,
+		"comparison": data.CompareTitles(titles),
+	}
+	err = app.writeResponse(w, r, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// bulkCreateResult is the outcome of creating one title in a bulk request. It holds the new title's id if it
+// was inserted, or its validation errors if it wasn't.
+type bulkCreateResult struct {
+	Index  int               `json:"index"`
+	ID     int64             `json:"id,omitempty"`
+	Errors map[string]string `json:"errors,omitempty"`
+}
+
+// bulkCreateTitlesHandler handles POST requests to the "/v1/titles/bulk" endpoint. Accepts a JSON array of
+// titles, or newline-delimited JSON with the Content-Type application/x-ndjson, with the same fields as
+// createTitleHandler. Each title is validated, and the valid ones are inserted in a single transaction. With
+// atomic=true, nothing is inserted unless every title is valid. Sends a result for each title, in order.
+func (app *application) bulkCreateTitlesHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	atomic := app.readBool(r.URL.Query(), "atomic", false, v)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	var input []struct {
+		TitleType   string `json:"title_type"`
+		Title       string `json:"title"`
+		Director    string `json:"director"`
+		Country     string `json:"country"`
+		ReleaseYear int32  `json:"release_year"`
+	}
+
+	var err error
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "application/x-ndjson" {
+		err = app.readNDJSON(w, r, &input)
+	} else {
+		err = app.readInput(w, r, &input)
+	}
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v.Check(len(input) > 0, "titles", "must contain at least one title")
+	v.Check(len(input) <= maxBulkTitles, "titles", fmt.Sprintf("must not contain more than %d titles", maxBulkTitles))
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// validate each title separately, so every title's errors can be reported
+	results := make([]bulkCreateResult, len(input))
+	valid := []*data.Title{}
+	validIndexes := []int{}
+	for i, item := range input {
+		title := &data.Title{
+			TitleType:   item.TitleType,
+			Title:       item.Title,
+			Director:    item.Director,
+			Country:     item.Country,
+			ReleaseYear: item.ReleaseYear,
+		}
+		results[i].Index = i
+
+		v := validator.New()
+		if data.ValidateTitle(v, title); !v.Valid() {
+			results[i].Errors = v.Errors
+			continue
+		}
+		valid = append(valid, title)
+		validIndexes = append(validIndexes, i)
+	}
+
+	// an atomic request with any invalid title inserts nothing
+	if atomic && len(valid) < len(input) {
+		app.errorResponse(w, r, http.StatusUnprocessableEntity, envelope{"results": results})
+		return
+	}
+
+	if len(valid) > 0 {
+		err = app.models.Titles.InsertMany(r.Context(), valid)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+	for i, title := range valid {
+		results[validIndexes[i]].ID = title.ID
+	}
+
+	// 201 Created if every title was inserted, or 200 OK if some were rejected
+	status := http.StatusCreated
+	if len(valid) < len(input) {
+		status = http.StatusOK
+	}
+	err = app.writeResponse(w, r, status, envelope{"results": results, "inserted": len(valid), "rejected": len(input) - len(valid)}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// bulkFilterInput holds the filters of a bulk update or delete request. They work the same way as
+// listTitlesHandler's filter params.
+type bulkFilterInput struct {
+	Title         string `json:"title"`
+	TitleMatch    string `json:"title_match"`
+	TitleType     string `json:"title_type"`
+	Director      string `json:"director"`
+	DirectorMatch string `json:"director_match"`
+	Country       string `json:"country"`
+}
+
+// filters converts the input to data.TitleFilters, with the same default match modes as readTitleFilters().
+func (f bulkFilterInput) filters() data.TitleFilters {
+	filters := data.TitleFilters{
+		Title:         f.Title,
+		TitleMatch:    f.TitleMatch,
+		TitleType:     f.TitleType,
+		Director:      f.Director,
+		DirectorMatch: f.DirectorMatch,
+		Country:       f.Country,
+	}
+	if filters.TitleMatch == "" {
+		filters.TitleMatch = data.MatchFTS
+	}
+	if filters.DirectorMatch == "" {
+		filters.DirectorMatch = data.MatchExact
+	}
+	return filters
+}
+
+// bulkUpdateTitlesHandler handles POST requests to the "/v1/titles/bulk-update" endpoint. Sets the fields in
+// "set" on every title that matches "filter". "dry_run" must always be given: a dry run changes nothing,
+// and sends the number of matching titles and a sample of them. To run the update, the client sends
+// dry_run=false with "expected_count" set to the count from its dry run.
+func (app *application) bulkUpdateTitlesHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Filter        bulkFilterInput  `json:"filter"`
+		Set           data.TitleUpdate `json:"set"`
+		DryRun        *bool            `json:"dry_run"`
+		ExpectedCount *int             `json:"expected_count"`
+	}
+
+	err := app.readInput(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	filters := input.Filter.filters()
+
+	v := validator.New()
+	data.ValidateBulkFilters(v, filters)
+	data.ValidateTitleUpdate(v, input.Set)
+	if validateDryRun(v, input.DryRun, input.ExpectedCount); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	expected := 0
+	if input.ExpectedCount != nil {
+		expected = *input.ExpectedCount
+	}
+	result, err := app.models.Titles.BulkUpdate(r.Context(), filters, input.Set, *input.DryRun, expected)
+	if err != nil {
+		app.bulkErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"result": result}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// bulkDeleteTitlesHandler handles POST requests to the "/v1/titles/bulk-delete" endpoint. Deletes every title
+// that matches "filter", with the same dry_run and expected_count rules as bulkUpdateTitlesHandler.
+func (app *application) bulkDeleteTitlesHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Filter        bulkFilterInput `json:"filter"`
+		DryRun        *bool           `json:"dry_run"`
+		ExpectedCount *int            `json:"expected_count"`
+	}
+
+	err := app.readInput(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	filters := input.Filter.filters()
+
+	v := validator.New()
+	data.ValidateBulkFilters(v, filters)
+	if validateDryRun(v, input.DryRun, input.ExpectedCount); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	expected := 0
+	if input.ExpectedCount != nil {
+		expected = *input.ExpectedCount
+	}
+	result, err := app.models.Titles.BulkDelete(r.Context(), filters, *input.DryRun, expected)
+	if err != nil {
+		app.bulkErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"result": result}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// validateDryRun checks that a bulk request says whether it's a dry run, and that a request that isn't a
+// dry run gives the count it expects to affect.
+func validateDryRun(v *validator.Validator, dryRun *bool, expectedCount *int) {
+	v.Check(dryRun != nil, "dry_run", "must be provided")
+	if dryRun != nil && !*dryRun {
+		v.Check(expectedCount != nil, "expected_count", "must be provided when dry_run is false")
+	}
+}
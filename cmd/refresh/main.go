@@ -0,0 +1,198 @@
+// Command refresh reconciles the titles table with a new snapshot of the Kaggle dataset, instead of
+// truncating the table and importing the snapshot again. New titles are inserted and changed titles are
+// updated; titles missing from the snapshot are only removed with -remove-missing. A report of the
+// additions, changes and removals is written as JSON or markdown. With -api-url, the API server is asked to
+// reload its caches afterwards.
+//
+// Usage:
+//
+//	go run ./cmd/refresh -db-dsn=$NETFLIX_DB_DSN -file=netflix_titles.csv -format=markdown
+//
+// A SQLite database is refreshed the same way, with a sqlite3:// DSN and the sqlite_fts5 build tag:
+//
+//	go run -tags sqlite_fts5 ./cmd/refresh -db-dsn=sqlite3://netflix.db -file=netflix_titles.csv
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"danielmatsuda15.rest/internal/data"
+	"danielmatsuda15.rest/internal/kaggle"
+	_ "github.com/lib/pq"
+)
+
+type config struct {
+	dsn           string
+	file          string
+	output        string
+	format        string
+	removeMissing bool
+	dryRun        bool
+	apiURL        string
+}
+
+// report is the output of a refresh: the diff, and whether it was applied to the titles table.
+type report struct {
+	DryRun        bool `json:"dry_run"`
+	RemoveMissing bool `json:"remove_missing"`
+	*kaggle.Diff
+}
+
+func main() {
+	var cfg config
+
+	flag.StringVar(&cfg.dsn, "db-dsn", "", "PostgreSQL DSN, or sqlite3://path for SQLite")
+	flag.StringVar(&cfg.file, "file", "netflix_titles.csv", "Path to the raw Kaggle dataset CSV")
+	flag.StringVar(&cfg.output, "output", "", "Path to write the report to (default stdout)")
+	flag.StringVar(&cfg.format, "format", "json", "Report format (json|markdown)")
+	flag.BoolVar(&cfg.removeMissing, "remove-missing", false, "Delete imported titles that are missing from the CSV")
+	flag.BoolVar(&cfg.dryRun, "dry-run", false, "Report the differences without changing the titles table")
+	flag.StringVar(&cfg.apiURL, "api-url", "", "Base URL of an API server to reload its caches after the refresh, e.g. http://localhost:4000")
+	flag.Parse()
+
+	// log to stderr, so the report can be piped from stdout
+	logger := log.New(os.Stderr, "", log.Ldate|log.Ltime)
+
+	if cfg.format != "json" && cfg.format != "markdown" {
+		logger.Fatalf("invalid -format %q: must be json or markdown", cfg.format)
+	}
+
+	db, err := openDB(cfg.dsn)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	defer db.Close()
+
+	titles := data.NewModels(db, data.DefaultQueryTimeout).Titles
+	if data.IsSQLiteDSN(cfg.dsn) {
+		titles = data.NewSQLiteModels(db, data.DefaultQueryTimeout).Titles
+	}
+
+	src, err := os.Open(cfg.file)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	defer src.Close()
+
+	// a dry run only reads the titles table. Otherwise the snapshot is compared with the table inside the
+	// refresh's transaction, so nothing written in the meantime is overwritten or missed
+	var diff *kaggle.Diff
+	if cfg.dryRun {
+		existing, err := titles.GetCatalog(context.Background())
+		if err != nil {
+			logger.Fatal(err)
+		}
+		diff, err = kaggle.Compare(src, existing)
+		if err != nil {
+			logger.Fatal(err)
+		}
+	} else {
+		err = titles.Refresh(context.Background(), func(existing []*data.CatalogTitle) ([]*data.CatalogTitle, []*data.CatalogTitle, []int64, error) {
+			var err error
+			diff, err = kaggle.Compare(src, existing)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			var removed []int64
+			if cfg.removeMissing {
+				removed = diff.RemovedIDs()
+			}
+			return diff.Added, diff.Updated(), removed, nil
+		})
+		if err != nil {
+			logger.Fatal(err)
+		}
+	}
+	logger.Printf("%d added, %d changed, %d missing, %d unchanged, %d rejected",
+		len(diff.Added), len(diff.Changed), len(diff.Removed), diff.Unchanged, len(diff.Rejected))
+
+	if !cfg.dryRun {
+		logger.Printf("titles table refreshed")
+
+		// the API servers can't observe this process's writes, so tell them to reload their caches
+		if cfg.apiURL != "" {
+			err = reloadCaches(cfg.apiURL)
+			if err != nil {
+				logger.Printf("couldn't reload the API's caches: %v", err)
+			} else {
+				logger.Printf("API caches reloaded")
+			}
+		}
+	}
+
+	var out io.Writer = os.Stdout
+	if cfg.output != "" {
+		file, err := os.Create(cfg.output)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		defer file.Close()
+		out = file
+	}
+
+	r := report{DryRun: cfg.dryRun, RemoveMissing: cfg.removeMissing, Diff: diff}
+	switch cfg.format {
+	case "markdown":
+		err = writeMarkdown(out, r)
+	default:
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "\t")
+		err = enc.Encode(r)
+	}
+	if err != nil {
+		logger.Fatal(err)
+	}
+}
+
+// reloadCaches asks the API server at apiURL to flush its cached statistics and rebuild its embedded search
+// index, since they're only updated by writes made through the server itself.
+func reloadCaches(apiURL string) error {
+	client := &http.Client{Timeout: time.Minute}
+
+	resp, err := client.Post(strings.TrimSuffix(apiURL, "/")+"/v1/caches/reload", "application/json", nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("POST /v1/caches/reload: %s", resp.Status)
+	}
+	return nil
+}
+
+// openDB returns a sql.DB connection pool, after checking that the database can be reached.
+func openDB(dsn string) (*sql.DB, error) {
+	var db *sql.DB
+	var err error
+	if data.IsSQLiteDSN(dsn) {
+		db, err = data.OpenSQLite(dsn)
+	} else {
+		db, err = sql.Open("postgres", dsn)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// create a context with a 5-second timeout deadline
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err = db.PingContext(ctx)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
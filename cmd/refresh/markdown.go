@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"danielmatsuda15.rest/internal/data"
+)
+
+// writeMarkdown writes r as a markdown document: a summary table, followed by a section listing each
+// addition, change, removal and rejected row.
+func writeMarkdown(w io.Writer, r report) error {
+	b := bufio.NewWriter(w)
+
+	removedLabel := "Removed"
+	if !r.RemoveMissing {
+		removedLabel = "Missing (not removed)"
+	}
+
+	fmt.Fprintln(b, "# Dataset refresh")
+	fmt.Fprintln(b)
+	if r.DryRun {
+		fmt.Fprintln(b, "Dry run: the titles table was not changed.")
+		fmt.Fprintln(b)
+	}
+	fmt.Fprintln(b, "| | Titles |")
+	fmt.Fprintln(b, "|---|---|")
+	fmt.Fprintf(b, "| Added | %d |\n", len(r.Added))
+	fmt.Fprintf(b, "| Changed | %d |\n", len(r.Changed))
+	fmt.Fprintf(b, "| %s | %d |\n", removedLabel, len(r.Removed))
+	fmt.Fprintf(b, "| Unchanged | %d |\n", r.Unchanged)
+	fmt.Fprintf(b, "| Rejected | %d |\n", len(r.Rejected))
+
+	if len(r.Added) > 0 {
+		fmt.Fprintf(b, "\n## Added\n\n")
+		for _, title := range r.Added {
+			fmt.Fprintf(b, "- %s\n", describe(title))
+		}
+	}
+
+	if len(r.Changed) > 0 {
+		fmt.Fprintf(b, "\n## Changed\n")
+		for _, change := range r.Changed {
+			fmt.Fprintf(b, "\n### %s: %s (id %d)\n\n", change.ShowID, escape(change.Title), change.ID)
+			fmt.Fprintln(b, "| Field | Old | New |")
+			fmt.Fprintln(b, "|---|---|---|")
+
+			columns := make([]string, 0, len(change.Fields))
+			for column := range change.Fields {
+				columns = append(columns, column)
+			}
+			sort.Strings(columns)
+			for _, column := range columns {
+				field := change.Fields[column]
+				fmt.Fprintf(b, "| %s | %s | %s |\n", column, value(field.Old), value(field.New))
+			}
+		}
+	}
+
+	if len(r.Removed) > 0 {
+		fmt.Fprintf(b, "\n## %s\n\n", removedLabel)
+		for _, title := range r.Removed {
+			fmt.Fprintf(b, "- %s (id %d)\n", describe(title), title.ID)
+		}
+	}
+
+	if len(r.Rejected) > 0 {
+		fmt.Fprintf(b, "\n## Rejected\n\n")
+		for _, row := range r.Rejected {
+			errs := make([]string, 0, len(row.Errors))
+			for field, msg := range row.Errors {
+				errs = append(errs, field+" "+msg)
+			}
+			sort.Strings(errs)
+			fmt.Fprintf(b, "- row %d %s: %s\n", row.Row, row.ShowID, escape(strings.Join(errs, "; ")))
+		}
+	}
+
+	return b.Flush()
+}
+
+// describe returns a one-line description of title, e.g. "s1: Dick Johnson Is Dead (Movie, 2020)".
+func describe(title *data.CatalogTitle) string {
+	return fmt.Sprintf("%s: %s (%s, %d)", title.ShowID, escape(title.Title.Title), title.TitleType, title.ReleaseYear)
+}
+
+// value formats a field's value for a table cell. A missing value is shown as an empty cell.
+func value(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	return escape(fmt.Sprint(v))
+}
+
+// escape stops s from breaking out of a markdown table cell or list item.
+func escape(s string) string {
+	return strings.NewReplacer("|", `\|`, "\n", " ").Replace(s)
+}
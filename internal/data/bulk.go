@@ -0,0 +1,233 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"danielmatsuda15.rest/internal/validator"
+)
+
+// maxBulkSample is the most matching titles a bulk operation returns as a sample.
+const maxBulkSample = 10
+
+var (
+	// ErrCountMismatch is returned when a bulk operation would affect a different number of titles than the
+	// client expected from its dry run, e.g. because titles were written in between.
+	ErrCountMismatch = errors.New("affected title count doesn't match the expected count")
+)
+
+// TitleUpdate holds the fields that a bulk update sets on every matching title. nil fields are left unchanged.
+type TitleUpdate struct {
+	TitleType   *string `json:"title_type"`
+	Title       *string `json:"title"`
+	Director    *string `json:"director"`
+	Country     *string `json:"country"`
+	ReleaseYear *int32  `json:"release_year"`
+}
+
+// ValidateTitleUpdate checks that the update sets at least one field, and that each field it sets would
+// pass ValidateTitle().
+func ValidateTitleUpdate(v *validator.Validator, update TitleUpdate) {
+	v.Check(update.TitleType != nil || update.Title != nil || update.Director != nil ||
+		update.Country != nil || update.ReleaseYear != nil, "set", "must contain at least one field")
+
+	if update.TitleType != nil {
+		v.Check(*update.TitleType != "", "title_type", "must be provided")
+	}
+	if update.Title != nil {
+		v.Check(*update.Title != "", "title", "must be provided")
+	}
+	if update.Director != nil {
+		v.Check(*update.Director != "", "director", "must be provided")
+	}
+	if update.Country != nil {
+		v.Check(*update.Country != "", "country", "must be provided")
+	}
+	if update.ReleaseYear != nil {
+		v.Check(*update.ReleaseYear >= 1888, "release_year", "must be greater than 1888")
+		v.Check(*update.ReleaseYear <= int32(time.Now().Year()), "release_year", "must not be in the future")
+	}
+}
+
+// ValidateBulkFilters checks that a bulk operation is filtered, so it can't affect the whole table by accident.
+func ValidateBulkFilters(v *validator.Validator, f TitleFilters) {
+	v.Check(f.Title != "" || f.TitleType != "" || f.Director != "" || f.Country != "", "filter", "must contain at least one filter")
+	ValidateTitleFilters(v, f)
+}
+
+// BulkResult describes the titles a bulk operation affected, or would affect if it was a dry run. Sample holds
+// the first few matching titles, by id, as they were before the operation.
+type BulkResult struct {
+	DryRun   bool     `json:"dry_run"`
+	Affected int      `json:"affected"`
+	Sample   []*Title `json:"sample"`
+}
+
+// BulkUpdate sets the fields in update on every title that matches filters, in a single transaction. If
+// dryRun is true, nothing is changed, and the result shows what would have been. Otherwise, expected must
+// be the number of matching titles (e.g. from a dry run), or ErrCountMismatch is returned and nothing is
+// changed.
+func (t TitleModel) BulkUpdate(ctx context.Context, filters TitleFilters, update TitleUpdate, dryRun bool, expected int) (*BulkResult, error) {
+	// build the SET clause from the fields that are being changed. Their placeholders come before
+	// the filters' placeholders
+	set := []string{}
+	args := []interface{}{}
+	for _, field := range []struct {
+		column string
+		value  interface{}
+		ok     bool
+	}{
+		{"title_type", update.TitleType, update.TitleType != nil},
+		{"title", update.Title, update.Title != nil},
+		{"director", update.Director, update.Director != nil},
+		{"country", update.Country, update.Country != nil},
+		{"release_year", update.ReleaseYear, update.ReleaseYear != nil},
+	} {
+		if field.ok {
+			args = append(args, field.value)
+			set = append(set, fmt.Sprintf("%s = $%d", field.column, len(args)))
+		}
+	}
+	where, args := filters.whereClause(args)
+
+	query := fmt.Sprintf(`
+	UPDATE titles
+	SET %s
+	%s
+	RETURNING %s`, strings.Join(set, ", "), where, titleColumns)
+
+	return t.bulk(ctx, filters, dryRun, expected, func(ctx context.Context, tx *sql.Tx) ([]int64, []*Title, error) {
+		rows, err := tx.QueryContext(ctx, query, args...)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer rows.Close()
+
+		titles := []*Title{}
+		for rows.Next() {
+			var title Title
+			err := scanTitle(rows, &title)
+			if err != nil {
+				return nil, nil, err
+			}
+			titles = append(titles, &title)
+		}
+		return nil, titles, rows.Err()
+	})
+}
+
+// BulkDelete deletes every title that matches filters, in a single transaction. dryRun and expected work
+// the same way as in BulkUpdate().
+func (t TitleModel) BulkDelete(ctx context.Context, filters TitleFilters, dryRun bool, expected int) (*BulkResult, error) {
+	where, args := filters.whereClause(nil)
+	query := fmt.Sprintf(`
+	DELETE FROM titles
+	%s
+	RETURNING id`, where)
+
+	return t.bulk(ctx, filters, dryRun, expected, func(ctx context.Context, tx *sql.Tx) ([]int64, []*Title, error) {
+		rows, err := tx.QueryContext(ctx, query, args...)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer rows.Close()
+
+		ids := []int64{}
+		for rows.Next() {
+			var id int64
+			err := rows.Scan(&id)
+			if err != nil {
+				return nil, nil, err
+			}
+			ids = append(ids, id)
+		}
+		return ids, nil, rows.Err()
+	})
+}
+
+// bulk runs a bulk operation in a transaction. The matching titles are locked and counted first. Then, unless
+// it's a dry run or the count isn't what the client expected, exec runs the operation and returns the ids of
+// the deleted titles or the updated titles, so the observers can be notified once it's committed. FOR UPDATE
+// doesn't stop new matching titles from being inserted in the meantime, so the operation is rolled back if
+// the number of titles it actually affected isn't what the client expected either.
+func (t TitleModel) bulk(ctx context.Context, filters TitleFilters, dryRun bool, expected int, exec func(ctx context.Context, tx *sql.Tx) ([]int64, []*Title, error)) (*BulkResult, error) {
+	// bulk operations can touch the whole table, so they get more time than a single query
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	// release context's resources before bulk() returns. Otherwise, those resources will be held
+	// until timeout or the parent context is canceled. Prevents memory leaks!
+	defer cancel()
+
+	tx, err := t.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	// Rollback() is a no-op once the transaction has been committed
+	defer tx.Rollback()
+
+	// lock the matching titles, so the count can't change before the operation runs
+	where, args := filters.whereClause(nil)
+	query := fmt.Sprintf(`
+	SELECT %s
+	FROM titles
+	%s
+	ORDER BY id
+	FOR UPDATE`, titleColumns, where)
+
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := &BulkResult{DryRun: dryRun, Sample: []*Title{}}
+	for rows.Next() {
+		var title Title
+		err := scanTitle(rows, &title)
+		if err != nil {
+			return nil, err
+		}
+		result.Affected++
+		if len(result.Sample) < maxBulkSample {
+			result.Sample = append(result.Sample, &title)
+		}
+	}
+
+	// confirm there were no errors during the calls to row.Next()
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	if dryRun {
+		return result, nil
+	}
+	if result.Affected != expected {
+		return nil, ErrCountMismatch
+	}
+
+	deleted, saved, err := exec(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+	if len(deleted)+len(saved) != expected {
+		return nil, ErrCountMismatch
+	}
+
+	err = commitAndNotify(t.commitMu, tx, func() {
+		for _, id := range deleted {
+			t.deleted(id)
+		}
+		for _, title := range saved {
+			t.saved(title)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
@@ -0,0 +1,93 @@
+package data
+
+import (
+	"strings"
+)
+
+// FieldComparison holds one field's value for each compared title, in the same order as the titles.
+type FieldComparison struct {
+	Equal  bool          `json:"equal"`
+	Values []interface{} `json:"values"`
+}
+
+// Comparison is a field-by-field comparison of two or more titles.
+type Comparison struct {
+	Fields map[string]FieldComparison `json:"fields"`
+	Shared SharedAttributes           `json:"shared"`
+}
+
+// SharedAttributes summarizes what all the compared titles have in common. Fields lists the fields whose
+// values are equal, and Directors and Countries list the entries every title's list contains.
+type SharedAttributes struct {
+	Fields    []string `json:"fields"`
+	Directors []string `json:"directors"`
+	Countries []string `json:"countries"`
+}
+
+// CompareTitles compares the fields of titles, which should hold at least two titles.
+func CompareTitles(titles []*Title) Comparison {
+	comparison := Comparison{
+		Fields: make(map[string]FieldComparison),
+		Shared: SharedAttributes{
+			Fields:    []string{},
+			Directors: sharedEntries(titles, func(t *Title) string { return t.Director }),
+			Countries: sharedEntries(titles, func(t *Title) string { return t.Country }),
+		},
+	}
+
+	fields := []struct {
+		name  string
+		value func(t *Title) interface{}
+	}{
+		{"title_type", func(t *Title) interface{} { return t.TitleType }},
+		{"title", func(t *Title) interface{} { return t.Title }},
+		{"director", func(t *Title) interface{} { return t.Director }},
+		{"country", func(t *Title) interface{} { return t.Country }},
+		{"release_year", func(t *Title) interface{} { return t.ReleaseYear }},
+	}
+	for _, field := range fields {
+		fc := FieldComparison{Equal: true, Values: []interface{}{}}
+		for _, title := range titles {
+			value := field.value(title)
+			if len(fc.Values) > 0 && value != fc.Values[0] {
+				fc.Equal = false
+			}
+			fc.Values = append(fc.Values, value)
+		}
+		comparison.Fields[field.name] = fc
+		if fc.Equal {
+			comparison.Shared.Fields = append(comparison.Shared.Fields, field.name)
+		}
+	}
+
+	return comparison
+}
+
+// sharedEntries returns the entries of a comma-separated list field that every title has, in the order
+// the first title lists them. Entries are compared case-insensitively.
+func sharedEntries(titles []*Title, list func(t *Title) string) []string {
+	shared := []string{}
+	if len(titles) == 0 {
+		return shared
+	}
+
+	counts := make(map[string]int)
+	for _, title := range titles {
+		seen := make(map[string]bool)
+		for _, entry := range splitList(list(title)) {
+			key := strings.ToLower(entry)
+			if !seen[key] {
+				seen[key] = true
+				counts[key]++
+			}
+		}
+	}
+	for _, entry := range splitList(list(titles[0])) {
+		if counts[strings.ToLower(entry)] == len(titles) {
+			shared = append(shared, entry)
+			// only list each entry once
+			counts[strings.ToLower(entry)] = 0
+		}
+	}
+	return shared
+}
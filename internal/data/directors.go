@@ -0,0 +1,146 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Director is a distinct name from the titles table's director column, with the number of titles they directed.
+type Director struct {
+	Name       string `json:"name"`
+	TitleCount int    `json:"title_count"`
+}
+
+// DirectorModel lists the directors in the titles table. The director column holds a comma-separated list
+// (e.g. "Matt Duffer, Ross Duffer"), so each name in the list is treated as a separate director.
+type DirectorModel struct {
+	titles TitleRepository
+}
+
+// GetAll returns a page of directors, ordered by their number of titles (most first), then by name. If search
+// isn't empty, only the directors whose names contain it are returned.
+func (d DirectorModel) GetAll(ctx context.Context, search string, p Pagination) ([]*Director, Metadata, error) {
+	return d.titles.Directors(ctx, search, p)
+}
+
+// GetTitles returns the filmography of the director with the given name (case-insensitive), ordered by
+// release_year. Returns an ErrRecordNotFound error if they haven't directed any titles.
+func (d DirectorModel) GetTitles(ctx context.Context, name string) ([]*Title, error) {
+	return d.titles.DirectorTitles(ctx, name)
+}
+
+// Directors returns a page of directors for DirectorModel.GetAll().
+func (t TitleModel) Directors(ctx context.Context, search string, p Pagination) ([]*Director, Metadata, error) {
+	// each (title, director) pair is only counted once, in case a director is listed twice on a title.
+	// count(*) OVER() is the total number of directors before the LIMIT is applied
+	query := `
+	SELECT count(*) OVER(), name, COUNT(*)
+	FROM (
+		SELECT DISTINCT id, TRIM(d) AS name
+		FROM titles, regexp_split_to_table(director, ',') AS d
+	) AS directors
+	WHERE name <> ''
+	AND LOWER(name) LIKE $1
+	GROUP BY name
+	ORDER BY COUNT(*) DESC, name
+	LIMIT $2 OFFSET $3`
+
+	args := []interface{}{"%" + escapeLike(strings.ToLower(search)) + "%", p.limit(), p.offset()}
+
+	// derive a context from ctx, with the query timeout as its deadline
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	// release context's resources before Directors() returns. Otherwise, those resources will be held
+	// until timeout or the parent context is canceled. Prevents memory leaks!
+	defer cancel()
+
+	rows, err := t.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	directors := []*Director{}
+	for rows.Next() {
+		var director Director
+		err := rows.Scan(&totalRecords, &director.Name, &director.TitleCount)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		directors = append(directors, &director)
+	}
+
+	// confirm there were no errors during the calls to row.Next()
+	err = rows.Err()
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return directors, calculateMetadata(totalRecords, p), nil
+}
+
+// DirectorTitles returns a director's titles for DirectorModel.GetTitles().
+func (t TitleModel) DirectorTitles(ctx context.Context, name string) ([]*Title, error) {
+	// the LIKE condition narrows the search down using the director trigram index, then the names in
+	// each director list are compared exactly
+	query := fmt.Sprintf(`
+	SELECT %s
+	FROM titles
+	WHERE LOWER(director) LIKE $2
+	AND LOWER($1) IN (SELECT LOWER(TRIM(d)) FROM regexp_split_to_table(director, ',') AS d)
+	ORDER BY release_year, id`, titleColumns)
+
+	name = strings.TrimSpace(name)
+	args := []interface{}{name, "%" + escapeLike(strings.ToLower(name)) + "%"}
+
+	// derive a context from ctx, with the query timeout as its deadline
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	// release context's resources before DirectorTitles() returns. Otherwise, those resources will be held
+	// until timeout or the parent context is canceled. Prevents memory leaks!
+	defer cancel()
+
+	rows, err := t.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	titles := []*Title{}
+	for rows.Next() {
+		var title Title
+		err := scanTitle(rows, &title)
+		if err != nil {
+			return nil, err
+		}
+		titles = append(titles, &title)
+	}
+
+	// confirm there were no errors during the calls to row.Next()
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(titles) == 0 {
+		return nil, ErrRecordNotFound
+	}
+	return titles, nil
+}
+
+// Collaborators returns the directors who co-directed any of titles with the director called name, with the
+// number of titles they share, most first.
+func Collaborators(name string, titles []*Title) []FacetCount {
+	counter := NewFacetCounter([]string{"director"})
+	for _, title := range titles {
+		counter.Add(title)
+	}
+
+	collaborators := []FacetCount{}
+	for _, count := range counter.Result(0)["director"] {
+		if !strings.EqualFold(count.Value, strings.TrimSpace(name)) {
+			collaborators = append(collaborators, count)
+		}
+	}
+	return collaborators
+}
@@ -0,0 +1,218 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"danielmatsuda15.rest/internal/validator"
+)
+
+// FacetFields lists the fields that facet counts can be requested for.
+var FacetFields = []string{"title_type", "country", "release_year", "director"}
+
+// FacetCount is the number of matching titles that have Value in a faceted field.
+type FacetCount struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+// FacetValues returns the values title has for a faceted field. The country and director columns hold
+// comma-separated lists (e.g. "United States, India"), so each entry in the list is counted separately.
+func FacetValues(title *Title, field string) []string {
+	switch field {
+	case "title_type":
+		return []string{title.TitleType}
+	case "release_year":
+		return []string{strconv.Itoa(int(title.ReleaseYear))}
+	case "country":
+		return splitList(title.Country)
+	case "director":
+		return splitList(title.Director)
+	default:
+		return nil
+	}
+}
+
+// splitList splits a comma-separated column value into its trimmed, non-empty entries.
+func splitList(s string) []string {
+	values := []string{}
+	for _, value := range strings.Split(s, ",") {
+		value = strings.TrimSpace(value)
+		if value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// FacetCounter tallies facet values across titles that were filtered in Go.
+type FacetCounter struct {
+	fields []string
+	counts map[string]map[string]int
+}
+
+// NewFacetCounter creates a FacetCounter for the given facet fields.
+func NewFacetCounter(fields []string) *FacetCounter {
+	counts := make(map[string]map[string]int)
+	for _, field := range fields {
+		counts[field] = make(map[string]int)
+	}
+	return &FacetCounter{fields: fields, counts: counts}
+}
+
+// Add counts each of title's facet values.
+func (c *FacetCounter) Add(title *Title) {
+	for _, field := range c.fields {
+		for _, value := range FacetValues(title, field) {
+			c.counts[field][value]++
+		}
+	}
+}
+
+// Result returns up to limit of the most common values per field, or all of them if limit is 0. The most
+// common values are first, and ties are ordered by value.
+func (c *FacetCounter) Result(limit int) map[string][]FacetCount {
+	facets := make(map[string][]FacetCount)
+	for field, counts := range c.counts {
+		values := []FacetCount{}
+		for value, count := range counts {
+			values = append(values, FacetCount{Value: value, Count: count})
+		}
+		sortFacetCounts(values)
+		if limit > 0 && len(values) > limit {
+			values = values[:limit]
+		}
+		facets[field] = values
+	}
+	return facets
+}
+
+// sortFacetCounts sorts values with the most common first. Ties are ordered by value.
+func sortFacetCounts(values []FacetCount) {
+	sort.Slice(values, func(i, j int) bool {
+		if values[i].Count != values[j].Count {
+			return values[i].Count > values[j].Count
+		}
+		return values[i].Value < values[j].Value
+	})
+}
+
+// facetQueries holds the query that counts each faceted field's values among the matching titles. Each
+// query selects the facet's name, a value and the value's count, so they can be combined with UNION ALL.
+var facetQueries = map[string]string{
+	"title_type": `
+	SELECT 'title_type' AS facet, title_type AS value, COUNT(*) AS count
+	FROM matches
+	GROUP BY 2`,
+	"country": `
+	SELECT 'country' AS facet, TRIM(c) AS value, COUNT(*) AS count
+	FROM matches, regexp_split_to_table(country, ',') AS c
+	WHERE TRIM(c) <> ''
+	GROUP BY 2`,
+	"release_year": `
+	SELECT 'release_year' AS facet, release_year::text AS value, COUNT(*) AS count
+	FROM matches
+	GROUP BY 2`,
+	"director": `
+	SELECT 'director' AS facet, TRIM(d) AS value, COUNT(*) AS count
+	FROM matches, regexp_split_to_table(director, ',') AS d
+	WHERE TRIM(d) <> ''
+	GROUP BY 2`,
+}
+
+// ValidateFacets checks that each requested facet field is supported, and only requested once.
+func ValidateFacets(v *validator.Validator, fields []string) {
+	for _, field := range fields {
+		v.Check(validator.In(field, FacetFields...), "facets", "must only contain "+strings.Join(FacetFields, ", "))
+	}
+	v.Check(validator.Unique(fields), "facets", "must not contain duplicate values")
+}
+
+// Facets returns up to limit of the most common values of each of the given fields, among the titles that
+// match filters. All the fields are counted in a single query.
+func (t TitleModel) Facets(ctx context.Context, filters TitleFilters, fields []string, limit int) (map[string][]FacetCount, error) {
+	return t.CountFacets(ctx, filters, facetLimits(fields, limit))
+}
+
+// facetLimits maps each of fields to limit, for CountFacets().
+func facetLimits(fields []string, limit int) map[string]int {
+	limits := make(map[string]int)
+	for _, field := range fields {
+		limits[field] = limit
+	}
+	return limits
+}
+
+// CountFacets counts the values of each field in limits among the titles that match filters, in a single
+// query. limits maps each field to the most values to return for it, or 0 to return all of them.
+func (t TitleModel) CountFacets(ctx context.Context, filters TitleFilters, limits map[string]int) (map[string][]FacetCount, error) {
+	facets := make(map[string][]FacetCount)
+	if len(limits) == 0 {
+		return facets, nil
+	}
+
+	// the matching titles are found once, in the CTE, then each facet is counted from them
+	where, args := filters.whereClause(nil)
+	subqueries := []string{}
+	for _, field := range FacetFields {
+		limit, ok := limits[field]
+		if !ok {
+			continue
+		}
+		facets[field] = []FacetCount{}
+
+		// LIMIT NULL is the same as no limit
+		if limit > 0 {
+			args = append(args, limit)
+		} else {
+			args = append(args, nil)
+		}
+		subquery := fmt.Sprintf("(%s\n\tORDER BY count DESC, value\n\tLIMIT $%d)", facetQueries[field], len(args))
+		subqueries = append(subqueries, subquery)
+	}
+	query := fmt.Sprintf(`
+	WITH matches AS (
+		SELECT *
+		FROM titles
+		%s
+	)
+	%s`, where, strings.Join(subqueries, "\n\tUNION ALL"))
+
+	// derive a context from ctx, with the query timeout as its deadline
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	// release context's resources before CountFacets() returns. Otherwise, those resources will be held
+	// until timeout or the parent context is canceled. Prevents memory leaks!
+	defer cancel()
+
+	rows, err := t.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var field string
+		var count FacetCount
+		err := rows.Scan(&field, &count.Value, &count.Count)
+		if err != nil {
+			return nil, err
+		}
+		facets[field] = append(facets[field], count)
+	}
+
+	// confirm there were no errors during the calls to row.Next()
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	// UNION ALL doesn't guarantee the subqueries' rows come back in order, so sort each facet again
+	for _, values := range facets {
+		sortFacetCounts(values)
+	}
+
+	return facets, nil
+}
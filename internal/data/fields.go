@@ -0,0 +1,149 @@
+package data
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+
+	"danielmatsuda15.rest/internal/validator"
+)
+
+// TitleFields lists the fields of a Title that a client can select with a Fieldset, in the order they're
+// sent. Each is also the name of its column in the titles table.
+var TitleFields = []string{"id", "title_type", "title", "director", "country", "release_year"}
+
+// titleFieldValues maps each of TitleFields to the Title field its column is scanned into.
+var titleFieldValues = map[string]func(*Title) interface{}{
+	"id":           func(t *Title) interface{} { return &t.ID },
+	"title_type":   func(t *Title) interface{} { return &t.TitleType },
+	"title":        func(t *Title) interface{} { return &t.Title },
+	"director":     func(t *Title) interface{} { return &t.Director },
+	"country":      func(t *Title) interface{} { return &t.Country },
+	"release_year": func(t *Title) interface{} { return &t.ReleaseYear },
+}
+
+// titleColumns is the column list to SELECT or RETURN for a whole Title. Every query that reads whole titles
+// uses it with scanTitle(), so the columns and the fields they're scanned into can't get out of step.
+var titleColumns = strings.Join(TitleFields, ", ")
+
+// scanner is a *sql.Row or *sql.Rows.
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanTitle scans the titleColumns of r into title, followed by any extra columns the query selected after
+// them into extra.
+func scanTitle(r scanner, title *Title, extra ...interface{}) error {
+	return r.Scan(append(Fieldset(nil).dest(title), extra...)...)
+}
+
+// Fieldset is the subset of TitleFields a client asked for, so only those columns are selected and sent.
+// An empty Fieldset means every field.
+type Fieldset []string
+
+// ValidateFieldset checks that every field in f is one of TitleFields, and that none are repeated.
+func ValidateFieldset(v *validator.Validator, f Fieldset) {
+	for _, field := range f {
+		if !validator.In(field, TitleFields...) {
+			v.AddError("fields", "must only contain "+strings.Join(TitleFields, ", "))
+			break
+		}
+	}
+	v.Check(validator.Unique(f), "fields", "must not contain duplicate values")
+}
+
+// Fields returns the selected fields, in the order of TitleFields.
+func (f Fieldset) Fields() []string {
+	if len(f) == 0 {
+		return TitleFields
+	}
+	selected := make(map[string]bool)
+	for _, field := range f {
+		selected[field] = true
+	}
+	fields := []string{}
+	for _, field := range TitleFields {
+		if selected[field] {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// columns returns the column list to SELECT for the Fieldset.
+func (f Fieldset) columns() string {
+	return strings.Join(f.Fields(), ", ")
+}
+
+// withID returns the Fieldset with id added, if it's not already selected, for queries that need each
+// title's id to match it up.
+func (f Fieldset) withID() Fieldset {
+	if len(f) == 0 || validator.In("id", f...) {
+		return f
+	}
+	return append(Fieldset{"id"}, f...)
+}
+
+// dest returns pointers to title's fields for the Fieldset's columns, to pass to Scan().
+func (f Fieldset) dest(title *Title) []interface{} {
+	fields := f.Fields()
+	dest := make([]interface{}, 0, len(fields))
+	for _, field := range fields {
+		dest = append(dest, titleFieldValues[field](title))
+	}
+	return dest
+}
+
+// Values returns the values of title's selected fields, in the order of Fields().
+func (f Fieldset) Values(title *Title) []interface{} {
+	values := []interface{}{}
+	for _, field := range f.Fields() {
+		switch value := titleFieldValues[field](title).(type) {
+		case *int64:
+			values = append(values, *value)
+		case *int32:
+			values = append(values, *value)
+		case *string:
+			values = append(values, *value)
+		}
+	}
+	return values
+}
+
+// Project returns title with only the selected fields, for sending to the client. The fields are marshaled
+// to JSON in the same order as a whole Title.
+func (f Fieldset) Project(title *Title) interface{} {
+	if len(f) == 0 {
+		return title
+	}
+	return partialTitle{fields: f.Fields(), title: title}
+}
+
+// partialTitle is a Title that only marshals some of its fields.
+type partialTitle struct {
+	fields []string
+	title  *Title
+}
+
+func (p partialTitle) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, field := range p.fields {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, err := json.Marshal(field)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(titleFieldValues[field](p.title))
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,226 @@
+package data
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"danielmatsuda15.rest/internal/validator"
+)
+
+// match modes supported by the title and director filters
+const (
+	MatchExact    = "exact"
+	MatchPrefix   = "prefix"
+	MatchContains = "contains"
+	MatchFTS      = "fts"
+)
+
+// MatchModes lists every match mode a client may request, in the order they're documented.
+var MatchModes = []string{MatchExact, MatchPrefix, MatchContains, MatchFTS}
+
+// TitleFilters holds the client's filter params for queries against the titles table.
+// An empty string means that filter isn't applied. The JSON tags are used to store an export job's filters.
+type TitleFilters struct {
+	Title         string `json:"title,omitempty"`
+	TitleMatch    string `json:"title_match,omitempty"`
+	Country       string `json:"country,omitempty"`
+	TitleType     string `json:"title_type,omitempty"`
+	Director      string `json:"director,omitempty"`
+	DirectorMatch string `json:"director_match,omitempty"`
+}
+
+// ValidateTitleFilters checks that the requested match modes are supported.
+func ValidateTitleFilters(v *validator.Validator, f TitleFilters) {
+	v.Check(validator.In(f.TitleMatch, MatchModes...), "title_match", "must be one of "+strings.Join(MatchModes, ", "))
+	v.Check(validator.In(f.DirectorMatch, MatchModes...), "director_match", "must be one of "+strings.Join(MatchModes, ", "))
+}
+
+// whereClause builds a SQL WHERE clause from the non-empty filters. The filter values are appended to args,
+// and the placeholders are numbered to follow any args that were already there. Returns an empty string
+// if no filters were given.
+func (f TitleFilters) whereClause(args []interface{}) (string, []interface{}) {
+	conditions, args := f.conditions(args)
+	return where(conditions), args
+}
+
+// conditions returns one SQL condition per non-empty filter, so callers can add their own conditions
+// before joining them with where().
+func (f TitleFilters) conditions(args []interface{}) ([]string, []interface{}) {
+	conditions := []string{}
+
+	if f.Title != "" {
+		var condition string
+		condition, args = matchCondition("title", f.TitleMatch, f.Title, args)
+		conditions = append(conditions, condition)
+	}
+	// PostgreSQL allows for full text searches:
+	// https://www.postgresql.org/docs/13/textsearch-intro.html#TEXTSEARCH-MATCHING
+	if f.Country != "" {
+		args = append(args, f.Country)
+		conditions = append(conditions, fmt.Sprintf("to_tsvector('simple', country) @@ plainto_tsquery('simple', $%d)", len(args)))
+	}
+	if f.TitleType != "" {
+		args = append(args, f.TitleType)
+		conditions = append(conditions, fmt.Sprintf("LOWER(title_type) = LOWER($%d)", len(args)))
+	}
+	if f.Director != "" {
+		var condition string
+		condition, args = matchCondition("director", f.DirectorMatch, f.Director, args)
+		conditions = append(conditions, condition)
+	}
+
+	return conditions, args
+}
+
+// where joins conditions into a WHERE clause, or returns an empty string if there are none.
+func where(conditions []string) string {
+	if len(conditions) == 0 {
+		return ""
+	}
+	return "WHERE " + strings.Join(conditions, "\n\tAND ")
+}
+
+// matchCondition returns the SQL condition that compares column against value using the given match mode.
+// The prefix and contains modes are served by the indexes on LOWER(column) from migration 000005.
+func matchCondition(column, mode, value string, args []interface{}) (string, []interface{}) {
+	switch mode {
+	case MatchPrefix:
+		args = append(args, escapeLike(strings.ToLower(value))+"%")
+		return fmt.Sprintf("LOWER(%s) LIKE $%d", column, len(args)), args
+	case MatchContains:
+		args = append(args, "%"+escapeLike(strings.ToLower(value))+"%")
+		return fmt.Sprintf("LOWER(%s) LIKE $%d", column, len(args)), args
+	case MatchFTS:
+		args = append(args, value)
+		return fmt.Sprintf("to_tsvector('simple', %s) @@ plainto_tsquery('simple', $%d)", column, len(args)), args
+	default:
+		args = append(args, value)
+		return fmt.Sprintf("LOWER(%s) = LOWER($%d)", column, len(args)), args
+	}
+}
+
+// escapeLike escapes the LIKE wildcard characters in s, so they're matched literally.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// Matches reports whether title meets the filters' criteria, the same way the WHERE clause built by
+// whereClause() would. It's used by the parts of the API that filter titles in Go rather than in SQL.
+func (f TitleFilters) Matches(title *Title) bool {
+	if f.Title != "" && !matchValue(f.TitleMatch, title.Title, f.Title) {
+		return false
+	}
+	if f.Country != "" && !matchValue(MatchFTS, title.Country, f.Country) {
+		return false
+	}
+	if f.TitleType != "" && !strings.EqualFold(title.TitleType, f.TitleType) {
+		return false
+	}
+	if f.Director != "" && !matchValue(f.DirectorMatch, title.Director, f.Director) {
+		return false
+	}
+	return true
+}
+
+// matchValue compares a title's field value against a filter value using the given match mode.
+func matchValue(mode, fieldValue, filterValue string) bool {
+	switch mode {
+	case MatchPrefix:
+		return strings.HasPrefix(strings.ToLower(fieldValue), strings.ToLower(filterValue))
+	case MatchContains:
+		return strings.Contains(strings.ToLower(fieldValue), strings.ToLower(filterValue))
+	case MatchFTS:
+		// like plainto_tsquery(), every word in the filter value must appear in the field. A filter value
+		// without any words matches nothing
+		terms := Tokenize(filterValue)
+		if len(terms) == 0 {
+			return false
+		}
+		words := make(map[string]bool)
+		for _, word := range Tokenize(fieldValue) {
+			words[word] = true
+		}
+		for _, term := range terms {
+			if !words[term] {
+				return false
+			}
+		}
+		return true
+	default:
+		return strings.ToLower(fieldValue) == strings.ToLower(filterValue)
+	}
+}
+
+// Tokenize splits s into lowercase words, approximating PostgreSQL's 'simple' text search configuration.
+func Tokenize(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// Pagination holds the client's params for paginated lists.
+type Pagination struct {
+	Page     int
+	PageSize int
+}
+
+// ValidatePagination checks that the page and page size are within sensible bounds.
+func ValidatePagination(v *validator.Validator, p Pagination) {
+	v.Check(p.Page > 0, "page", "must be greater than zero")
+	v.Check(p.Page <= 10_000_000, "page", "must be a maximum of 10 million")
+	v.Check(p.PageSize > 0, "page_size", "must be greater than zero")
+	v.Check(p.PageSize <= 100, "page_size", "must be a maximum of 100")
+}
+
+func (p Pagination) limit() int {
+	return p.PageSize
+}
+
+func (p Pagination) offset() int {
+	return (p.Page - 1) * p.PageSize
+}
+
+// Metadata describes a page of results, so the client can request the other pages.
+type Metadata struct {
+	CurrentPage  int `json:"current_page,omitempty"`
+	PageSize     int `json:"page_size,omitempty"`
+	FirstPage    int `json:"first_page,omitempty"`
+	LastPage     int `json:"last_page,omitempty"`
+	TotalRecords int `json:"total_records,omitempty"`
+}
+
+// calculateMetadata returns the Metadata for a page of totalRecords results. If there are no results, the
+// Metadata is empty.
+func calculateMetadata(totalRecords int, p Pagination) Metadata {
+	if totalRecords == 0 {
+		return Metadata{}
+	}
+	return Metadata{
+		CurrentPage:  p.Page,
+		PageSize:     p.PageSize,
+		FirstPage:    1,
+		LastPage:     (totalRecords + p.PageSize - 1) / p.PageSize,
+		TotalRecords: totalRecords,
+	}
+}
+
+// FilterField describes a query string param that filters the titles, for clients that build their
+// filters dynamically.
+type FilterField struct {
+	Param           string   `json:"param"`
+	Column          string   `json:"column"`
+	MatchParam      string   `json:"match_param,omitempty"`
+	Operators       []string `json:"operators"`
+	DefaultOperator string   `json:"default_operator"`
+	ValuesURL       string   `json:"values_url,omitempty"`
+}
+
+// FilterFields describes every filter param read into TitleFilters. The operators are the match modes
+// that can be chosen with MatchParam, or the only way the field is matched if there's no MatchParam.
+var FilterFields = []FilterField{
+	{Param: "title", Column: "title", MatchParam: "title_match", Operators: MatchModes, DefaultOperator: MatchFTS},
+	{Param: "title_type", Column: "title_type", Operators: []string{MatchExact}, DefaultOperator: MatchExact, ValuesURL: "/v1/meta/title-types"},
+	{Param: "director", Column: "director", MatchParam: "director_match", Operators: MatchModes, DefaultOperator: MatchExact, ValuesURL: "/v1/directors"},
+	{Param: "country", Column: "country", Operators: []string{MatchFTS}, DefaultOperator: MatchFTS, ValuesURL: "/v1/meta/countries"},
+}
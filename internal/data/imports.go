@@ -0,0 +1,190 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// importTimeout is how long an import's transaction may stay open. Imports stream a whole dataset, so
+// they get much longer than a single query.
+const importTimeout = 5 * time.Minute
+
+// CatalogTitle is a title with the extra columns that are loaded from the Netflix catalog dataset, but
+// aren't part of the API's Title resource.
+type CatalogTitle struct {
+	Title
+	ShowID      string     `json:"show_id,omitempty"`
+	DateAdded   *time.Time `json:"date_added,omitempty"`
+	Rating      string     `json:"rating,omitempty"`
+	Description string     `json:"description,omitempty"`
+}
+
+// TitleImporter adds catalog titles to the titles table, all at once. Titles whose show_id is already in the
+// table, or was already added to the import, are skipped. Nothing is written until Commit() is called, and
+// Close() must always be called to release the import's resources.
+type TitleImporter interface {
+	// Add queues title to be imported. Returns false if the title was skipped because its show_id has
+	// already been imported.
+	Add(title *CatalogTitle) (bool, error)
+	// Commit writes the queued titles, and notifies the repository's observers of them.
+	Commit() error
+	// Close abandons the import if it hasn't been committed.
+	Close()
+}
+
+// copyImporter is TitleModel's TitleImporter. It streams the titles into the titles table with COPY FROM
+// STDIN, in a single transaction.
+type copyImporter struct {
+	titles   TitleModel
+	ctx      context.Context
+	cancel   context.CancelFunc
+	tx       *sql.Tx
+	stmt     *sql.Stmt
+	showIDs  map[string]bool
+	imported []string
+}
+
+// NewImporter starts an import into the titles table.
+func (t TitleModel) NewImporter(ctx context.Context) (TitleImporter, error) {
+	ctx, cancel := context.WithTimeout(ctx, importTimeout)
+
+	tx, err := t.DB.BeginTx(ctx, nil)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	i := &copyImporter{titles: t, ctx: ctx, cancel: cancel, tx: tx, showIDs: make(map[string]bool)}
+
+	// read the existing show ids first, since COPY can't skip rows that conflict with the unique index
+	rows, err := tx.QueryContext(ctx, `SELECT show_id FROM titles WHERE show_id IS NOT NULL`)
+	if err != nil {
+		i.Close()
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var showID string
+		err := rows.Scan(&showID)
+		if err != nil {
+			i.Close()
+			return nil, err
+		}
+		i.showIDs[showID] = true
+	}
+	err = rows.Err()
+	if err != nil {
+		i.Close()
+		return nil, err
+	}
+	// the connection must be free before the COPY starts
+	rows.Close()
+
+	// pq.CopyIn() builds a COPY titles (...) FROM STDIN statement. Each Exec() call on it buffers a row
+	i.stmt, err = tx.PrepareContext(ctx, pq.CopyIn("titles",
+		"show_id", "title_type", "title", "director", "country", "release_year",
+		"date_added", "rating", "description"))
+	if err != nil {
+		i.Close()
+		return nil, err
+	}
+
+	return i, nil
+}
+
+// Add queues title to be copied into the titles table. Returns false if the title was skipped because its
+// show_id has already been imported.
+func (i *copyImporter) Add(title *CatalogTitle) (bool, error) {
+	if i.showIDs[title.ShowID] {
+		return false, nil
+	}
+
+	_, err := i.stmt.ExecContext(i.ctx,
+		title.ShowID, title.TitleType, title.Title.Title, title.Director, title.Country, title.ReleaseYear,
+		title.DateAdded, nullString(title.Rating), nullString(title.Description))
+	if err != nil {
+		return false, err
+	}
+
+	i.showIDs[title.ShowID] = true
+	i.imported = append(i.imported, title.ShowID)
+	return true, nil
+}
+
+// Commit flushes the copied rows, reads the imported titles back so the TitleModel's observers can be
+// notified of them, and commits the import.
+func (i *copyImporter) Commit() error {
+	// an Exec() call without args flushes the COPY
+	_, err := i.stmt.ExecContext(i.ctx)
+	if err != nil {
+		return err
+	}
+	err = i.stmt.Close()
+	if err != nil {
+		return err
+	}
+
+	titles, err := i.readImported()
+	if err != nil {
+		return err
+	}
+
+	return commitAndNotify(i.titles.commitMu, i.tx, func() {
+		for _, title := range titles {
+			i.titles.saved(title)
+		}
+	})
+}
+
+// readImported reads the imported titles back in the import's transaction, since COPY can't return their ids.
+func (i *copyImporter) readImported() ([]*Title, error) {
+	if len(i.imported) == 0 {
+		return nil, nil
+	}
+
+	query := fmt.Sprintf(`
+	SELECT %s
+	FROM titles
+	WHERE show_id = ANY($1)`, titleColumns)
+
+	rows, err := i.tx.QueryContext(i.ctx, query, pq.Array(i.imported))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var titles []*Title
+	for rows.Next() {
+		var title Title
+		err := scanTitle(rows, &title)
+		if err != nil {
+			return nil, err
+		}
+		titles = append(titles, &title)
+	}
+	return titles, rows.Err()
+}
+
+// Close rolls back the import if it hasn't been committed, and releases its resources.
+func (i *copyImporter) Close() {
+	// the COPY has to end before the transaction can be rolled back. Rollback() is a no-op once the
+	// transaction has been committed
+	if i.stmt != nil {
+		i.stmt.Close()
+	}
+	i.tx.Rollback()
+	i.cancel()
+}
+
+// nullString converts an empty string to a SQL NULL.
+func nullString(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
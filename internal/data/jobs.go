@@ -0,0 +1,307 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// kinds of background job
+const (
+	JobImport = "import"
+	JobExport = "export"
+)
+
+// statuses a job moves through. A job is queued when it's created, running once a worker claims it, and
+// then either succeeded or failed. A running job is leased to the worker that claimed it, which renews the
+// lease until the job has finished; if the lease expires, e.g. because the worker's server crashed, the job
+// is requeued.
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+)
+
+// Job is a long-running import or export, which is run by a background worker instead of the request's
+// handler. Input holds an import's uploaded CSV, and Output holds an export's file once it has succeeded.
+type Job struct {
+	ID             int64           `json:"id"`
+	Kind           string          `json:"kind"`
+	Status         string          `json:"status"`
+	Params         json.RawMessage `json:"params,omitempty"`
+	Progress       int             `json:"progress"`
+	Result         json.RawMessage `json:"result,omitempty"`
+	ResultLocation string          `json:"result_location,omitempty"`
+	Error          string          `json:"error,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+	StartedAt      *time.Time      `json:"started_at,omitempty"`
+	FinishedAt     *time.Time      `json:"finished_at,omitempty"`
+	WorkerID       string          `json:"-"`
+	Input          []byte          `json:"-"`
+	Output         []byte          `json:"-"`
+}
+
+// JobModel wraps the jobs table, which doubles as the queue the background workers take jobs from.
+type JobModel struct {
+	DB      *sql.DB
+	timeout time.Duration
+}
+
+// Available reports whether jobs can be stored. They can't when the titles are kept in memory, since there's
+// no database to hold the jobs table.
+func (j JobModel) Available() bool {
+	return j.DB != nil
+}
+
+// Insert queues a new job. The job's ID, Status and CreatedAt are set from the new row.
+func (j JobModel) Insert(ctx context.Context, job *Job) error {
+	query := `
+	INSERT INTO jobs (kind, params, input)
+	VALUES ($1, $2, $3)
+	RETURNING id, status, created_at`
+
+	params := job.Params
+	if params == nil {
+		params = json.RawMessage("{}")
+	}
+	args := []interface{}{job.Kind, []byte(params), job.Input}
+
+	// derive a context from ctx, with the query timeout as its deadline
+	ctx, cancel := context.WithTimeout(ctx, j.timeout)
+	// release context's resources before Insert() returns. Otherwise, those resources will be held
+	// until timeout or the parent context is canceled. Prevents memory leaks!
+	defer cancel()
+
+	return j.DB.QueryRowContext(ctx, query, args...).Scan(&job.ID, &job.Status, &job.CreatedAt)
+}
+
+// Get returns the job with the given id, without its input or output. Returns an ErrRecordNotFound error if
+// there's no such job.
+func (j JobModel) Get(ctx context.Context, id int64) (*Job, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+	SELECT id, kind, status, params, progress, result, result_location, error, created_at, started_at, finished_at
+	FROM jobs
+	WHERE id = $1`
+
+	// derive a context from ctx, with the query timeout as its deadline
+	ctx, cancel := context.WithTimeout(ctx, j.timeout)
+	// release context's resources before Get() returns. Otherwise, those resources will be held
+	// until timeout or the parent context is canceled. Prevents memory leaks!
+	defer cancel()
+
+	job, err := scanJob(j.DB.QueryRowContext(ctx, query, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+	return job, nil
+}
+
+// Claim marks the oldest queued job as running, leased to workerID for lease, and returns it with its
+// input. Returns an ErrRecordNotFound error if no jobs are queued. FOR UPDATE SKIP LOCKED lets several
+// workers claim jobs at once without claiming the same one.
+func (j JobModel) Claim(ctx context.Context, workerID string, lease time.Duration) (*Job, error) {
+	query := `
+	UPDATE jobs
+	SET status = 'running', started_at = NOW(), worker_id = $1, locked_until = NOW() + $2 * INTERVAL '1 millisecond'
+	WHERE id = (
+		SELECT id FROM jobs
+		WHERE status = 'queued'
+		ORDER BY id
+		FOR UPDATE SKIP LOCKED
+		LIMIT 1
+	)
+	RETURNING id, kind, status, params, progress, result, result_location, error, created_at, started_at, finished_at, input`
+
+	// derive a context from ctx, with the query timeout as its deadline
+	ctx, cancel := context.WithTimeout(ctx, j.timeout)
+	// release context's resources before Claim() returns. Otherwise, those resources will be held
+	// until timeout or the parent context is canceled. Prevents memory leaks!
+	defer cancel()
+
+	var input []byte
+	job, err := scanJob(j.DB.QueryRowContext(ctx, query, workerID, lease.Milliseconds()), &input)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+	job.WorkerID = workerID
+	job.Input = input
+	return job, nil
+}
+
+// RenewLease extends the lease on a running job to lease from now. Returns an ErrRecordNotFound error if
+// the job's worker no longer holds the lease, e.g. because it expired and the job was requeued.
+func (j JobModel) RenewLease(ctx context.Context, job *Job, lease time.Duration) error {
+	query := `
+	UPDATE jobs
+	SET locked_until = NOW() + $3 * INTERVAL '1 millisecond'
+	WHERE id = $1 AND worker_id = $2 AND status = 'running'`
+
+	// derive a context from ctx, with the query timeout as its deadline
+	ctx, cancel := context.WithTimeout(ctx, j.timeout)
+	// release context's resources before RenewLease() returns. Otherwise, those resources will be held
+	// until timeout or the parent context is canceled. Prevents memory leaks!
+	defer cancel()
+
+	result, err := j.DB.ExecContext(ctx, query, job.ID, job.WorkerID, lease.Milliseconds())
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// UpdateProgress records how far through a running job is, as a percentage, if its worker still holds the
+// lease.
+func (j JobModel) UpdateProgress(ctx context.Context, job *Job, progress int) error {
+	query := `
+	UPDATE jobs
+	SET progress = $3
+	WHERE id = $1 AND worker_id = $2 AND status = 'running'`
+
+	// derive a context from ctx, with the query timeout as its deadline
+	ctx, cancel := context.WithTimeout(ctx, j.timeout)
+	// release context's resources before UpdateProgress() returns. Otherwise, those resources will be held
+	// until timeout or the parent context is canceled. Prevents memory leaks!
+	defer cancel()
+
+	_, err := j.DB.ExecContext(ctx, query, job.ID, job.WorkerID, progress)
+	return err
+}
+
+// Finish records the outcome of a running job: its Result, Output and ResultLocation if it succeeded, or its
+// Error if it failed. The job's input is no longer needed, so it's discarded. Returns an ErrRecordNotFound
+// error, without changing the job, if its worker no longer holds the lease.
+func (j JobModel) Finish(ctx context.Context, job *Job) error {
+	query := `
+	UPDATE jobs
+	SET status = $2, progress = $3, result = $4, output = $5, result_location = $6, error = $7,
+		finished_at = NOW(), input = NULL, locked_until = NULL
+	WHERE id = $1 AND worker_id = $8 AND status = 'running'
+	RETURNING finished_at`
+
+	var result interface{}
+	if job.Result != nil {
+		result = []byte(job.Result)
+	}
+	args := []interface{}{
+		job.ID, job.Status, job.Progress, result, job.Output, nullString(job.ResultLocation), nullString(job.Error),
+		job.WorkerID,
+	}
+
+	// derive a context from ctx, with the query timeout as its deadline
+	ctx, cancel := context.WithTimeout(ctx, j.timeout)
+	// release context's resources before Finish() returns. Otherwise, those resources will be held
+	// until timeout or the parent context is canceled. Prevents memory leaks!
+	defer cancel()
+
+	err := j.DB.QueryRowContext(ctx, query, args...).Scan(&job.FinishedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrRecordNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+// GetOutput returns the output of the job with the given id. Returns an ErrRecordNotFound error if there's
+// no such job, or it has no output.
+func (j JobModel) GetOutput(ctx context.Context, id int64) ([]byte, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+	SELECT output
+	FROM jobs
+	WHERE id = $1 AND output IS NOT NULL`
+
+	// create a context with a 30-second timeout deadline, since an export can be large
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	var output []byte
+	err := j.DB.QueryRowContext(ctx, query, id).Scan(&output)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+	return output, nil
+}
+
+// Requeue puts running jobs whose lease has expired back in the queue, e.g. after their worker's server
+// crashed, or that were claimed before leases were recorded. Jobs whose worker is still renewing its lease,
+// on this server or another, are left alone. Imports run in a single transaction and exports don't write to
+// the titles table, so both are safe to run again. Returns the number of requeued jobs.
+func (j JobModel) Requeue(ctx context.Context) (int64, error) {
+	query := `
+	UPDATE jobs
+	SET status = 'queued', progress = 0, started_at = NULL, worker_id = NULL, locked_until = NULL
+	WHERE status = 'running' AND (locked_until IS NULL OR locked_until < NOW())`
+
+	// derive a context from ctx, with the query timeout as its deadline
+	ctx, cancel := context.WithTimeout(ctx, j.timeout)
+	// release context's resources before Requeue() returns. Otherwise, those resources will be held
+	// until timeout or the parent context is canceled. Prevents memory leaks!
+	defer cancel()
+
+	result, err := j.DB.ExecContext(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// scanJob scans a row of the columns selected by Get() into a Job, followed by any extra columns into dest.
+func scanJob(row *sql.Row, dest ...interface{}) (*Job, error) {
+	var (
+		job            Job
+		params, result []byte
+		location, msg  sql.NullString
+	)
+	err := row.Scan(append([]interface{}{
+		&job.ID,
+		&job.Kind,
+		&job.Status,
+		&params,
+		&job.Progress,
+		&result,
+		&location,
+		&msg,
+		&job.CreatedAt,
+		&job.StartedAt,
+		&job.FinishedAt,
+	}, dest...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	job.Params = params
+	if result != nil {
+		job.Result = result
+	}
+	job.ResultLocation = location.String
+	job.Error = msg.String
+	return &job, nil
+}
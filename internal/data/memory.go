@@ -0,0 +1,791 @@
+package data
+
+import (
+	"context"
+	"crypto/md5"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// MemoryTitleModel is a TitleRepository that keeps the titles in memory instead of PostgreSQL, for handler
+// tests and the -db-driver=memory demo mode. Nothing is persisted, so it starts out empty every time.
+//
+// Full text searches are matched like TitleFilters.Matches() does, and pg_trgm similarity is approximated
+// in Go (see trigram.go), so results can differ slightly from TitleModel's for those. Everything else,
+// including the order of results and the errors returned, is the same. All methods are safe for concurrent use.
+type MemoryTitleModel struct {
+	mu        sync.RWMutex
+	titles    map[int64]*CatalogTitle
+	nextID    int64
+	observers []TitleObserver
+}
+
+// NewMemoryTitleModel creates an empty MemoryTitleModel.
+func NewMemoryTitleModel() *MemoryTitleModel {
+	return &MemoryTitleModel{titles: make(map[int64]*CatalogTitle), nextID: 1}
+}
+
+// Observe registers o to be notified after each successful write.
+func (m *MemoryTitleModel) Observe(o TitleObserver) {
+	m.observers = append(m.observers, o)
+}
+
+// saved notifies the observers that title was inserted or updated. m.mu must be held for writing, so the
+// observers see the writes in the same order as the stored titles.
+func (m *MemoryTitleModel) saved(title *Title) {
+	for _, o := range m.observers {
+		o.TitleSaved(title)
+	}
+}
+
+// deleted notifies the observers that the title with the given id was deleted. m.mu must be held for
+// writing.
+func (m *MemoryTitleModel) deleted(id int64) {
+	for _, o := range m.observers {
+		o.TitleDeleted(id)
+	}
+}
+
+// add stores a copy of title with the next id, like a new row's serial id, and returns the copy. m.mu must
+// be held for writing.
+func (m *MemoryTitleModel) add(title *CatalogTitle) *CatalogTitle {
+	stored := *title
+	stored.ID = m.nextID
+	m.nextID++
+	m.titles[stored.ID] = &stored
+	return &stored
+}
+
+// matching returns the stored titles that match filters, ordered by id. m.mu must be held.
+func (m *MemoryTitleModel) matching(filters TitleFilters) []*CatalogTitle {
+	titles := []*CatalogTitle{}
+	for _, title := range m.titles {
+		if filters.Matches(&title.Title) {
+			titles = append(titles, title)
+		}
+	}
+	sort.Slice(titles, func(i, j int) bool {
+		return titles[i].ID < titles[j].ID
+	})
+	return titles
+}
+
+// copyTitle returns a copy of title, so callers can't change the stored title.
+func copyTitle(title *Title) *Title {
+	c := *title
+	return &c
+}
+
+// project returns a copy of title with only the fields in fields set, like a row that only selected
+// their columns.
+func project(title *Title, fields Fieldset) *Title {
+	if len(fields) == 0 {
+		return copyTitle(title)
+	}
+	var c Title
+	dest := fields.dest(&c)
+	for i, value := range fields.Values(title) {
+		reflect.ValueOf(dest[i]).Elem().Set(reflect.ValueOf(value))
+	}
+	return &c
+}
+
+// CheckSchema always succeeds, since there's no schema to migrate.
+func (m *MemoryTitleModel) CheckSchema(ctx context.Context) error {
+	return ctx.Err()
+}
+
+// Insert stores title, and sets its ID.
+func (m *MemoryTitleModel) Insert(ctx context.Context, title *Title) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	title.ID = m.add(&CatalogTitle{Title: *title}).ID
+	m.saved(title)
+	return nil
+}
+
+// InsertMany stores titles, and sets each of their IDs.
+func (m *MemoryTitleModel) InsertMany(ctx context.Context, titles []*Title) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, title := range titles {
+		title.ID = m.add(&CatalogTitle{Title: *title}).ID
+		m.saved(title)
+	}
+	return nil
+}
+
+// Get returns the title with the given id, with only the fields in fields set, or every field if fields is
+// empty. Returns an ErrRecordNotFound error if there's no such title.
+func (m *MemoryTitleModel) Get(ctx context.Context, id int64, fields Fieldset) (*Title, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	title, ok := m.titles[id]
+	if !ok {
+		return nil, ErrRecordNotFound
+	}
+	return project(&title.Title, fields), nil
+}
+
+// GetMany returns the titles with the given ids, in the same order as ids, with only the fields in fields
+// and id set. Ids that don't exist are skipped.
+func (m *MemoryTitleModel) GetMany(ctx context.Context, ids []int64, fields Fieldset) ([]*Title, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	titles := []*Title{}
+	for _, id := range ids {
+		if title, ok := m.titles[id]; ok {
+			titles = append(titles, project(&title.Title, fields.withID()))
+		}
+	}
+	return titles, nil
+}
+
+// GetAll returns the titles that match filters, ordered by id, with only the fields in fields set.
+func (m *MemoryTitleModel) GetAll(ctx context.Context, filters TitleFilters, fields Fieldset) ([]*Title, error) {
+	titles := []*Title{}
+	err := m.GetAllFunc(ctx, filters, fields, func(title *Title) error {
+		titles = append(titles, title)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return titles, nil
+}
+
+// GetAllFunc calls fn with each title that GetAll() would return, in the same order. If fn returns an error,
+// or ctx is canceled, no more titles are sent and the error is returned.
+func (m *MemoryTitleModel) GetAllFunc(ctx context.Context, filters TitleFilters, fields Fieldset, fn func(*Title) error) error {
+	// copy the matches before calling fn, so a slow consumer doesn't hold up writes
+	m.mu.RLock()
+	titles := []*Title{}
+	for _, title := range m.matching(filters) {
+		titles = append(titles, project(&title.Title, fields))
+	}
+	m.mu.RUnlock()
+
+	for _, title := range titles {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		err := fn(title)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Update replaces the stored title with title.ID by title. The title's catalog fields are kept. Returns an
+// ErrRecordNotFound error if there's no such title.
+func (m *MemoryTitleModel) Update(ctx context.Context, title *Title) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.titles[title.ID]
+	if !ok {
+		return ErrRecordNotFound
+	}
+	stored.Title = *title
+	m.saved(title)
+	return nil
+}
+
+// Delete deletes the title with the given id. Returns an ErrRecordNotFound error if there's no such title.
+func (m *MemoryTitleModel) Delete(ctx context.Context, id int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.titles[id]; !ok {
+		return ErrRecordNotFound
+	}
+	delete(m.titles, id)
+	m.deleted(id)
+	return nil
+}
+
+// BulkUpdate sets the fields in update on every title that matches filters, the same way as
+// TitleModel.BulkUpdate().
+func (m *MemoryTitleModel) BulkUpdate(ctx context.Context, filters TitleFilters, update TitleUpdate, dryRun bool, expected int) (*BulkResult, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	result, matches, err := m.bulk(ctx, filters, dryRun, expected)
+	if err != nil {
+		return nil, err
+	}
+	if !dryRun {
+		for _, title := range matches {
+			if update.TitleType != nil {
+				title.TitleType = *update.TitleType
+			}
+			if update.Title != nil {
+				title.Title.Title = *update.Title
+			}
+			if update.Director != nil {
+				title.Director = *update.Director
+			}
+			if update.Country != nil {
+				title.Country = *update.Country
+			}
+			if update.ReleaseYear != nil {
+				title.ReleaseYear = *update.ReleaseYear
+			}
+			m.saved(copyTitle(&title.Title))
+		}
+	}
+	return result, nil
+}
+
+// BulkDelete deletes every title that matches filters, the same way as TitleModel.BulkDelete().
+func (m *MemoryTitleModel) BulkDelete(ctx context.Context, filters TitleFilters, dryRun bool, expected int) (*BulkResult, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	result, matches, err := m.bulk(ctx, filters, dryRun, expected)
+	if err != nil {
+		return nil, err
+	}
+	if !dryRun {
+		for _, title := range matches {
+			delete(m.titles, title.ID)
+			m.deleted(title.ID)
+		}
+	}
+	return result, nil
+}
+
+// bulk counts and samples the titles that match filters, and returns them so the operation can be applied.
+// Returns ErrCountMismatch if it isn't a dry run and the count isn't what the client expected. m.mu must be
+// held for writing.
+func (m *MemoryTitleModel) bulk(ctx context.Context, filters TitleFilters, dryRun bool, expected int) (*BulkResult, []*CatalogTitle, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	matches := m.matching(filters)
+	result := &BulkResult{DryRun: dryRun, Affected: len(matches), Sample: []*Title{}}
+	for _, title := range matches {
+		if len(result.Sample) == maxBulkSample {
+			break
+		}
+		result.Sample = append(result.Sample, copyTitle(&title.Title))
+	}
+
+	if !dryRun && result.Affected != expected {
+		return nil, nil, ErrCountMismatch
+	}
+	return result, matches, nil
+}
+
+// Suggest returns up to limit distinct titles that are spelled similarly to filters.Title, closest first,
+// among the titles that match the other filters.
+func (m *MemoryTitleModel) Suggest(ctx context.Context, filters TitleFilters, limit int) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	term := filters.Title
+	filters.Title = ""
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return suggestTitles(m.matching(filters), term, limit), nil
+}
+
+// suggestTitles returns up to limit distinct titles among titles that are spelled similarly to term,
+// closest first, like TitleModel.Suggest() does with pg_trgm.
+func suggestTitles(titles []*CatalogTitle, term string, limit int) []string {
+	termTrigrams := trigrams(term)
+	scores := make(map[string]float64)
+	for _, title := range titles {
+		similarity := trigramSimilarity(termTrigrams, trigrams(title.Title.Title))
+		wordSim := wordSimilarity(termTrigrams, title.Title.Title)
+		if similarity >= similarityThreshold || wordSim >= wordSimilarityThreshold {
+			scores[title.Title.Title] = math.Max(similarity, wordSim)
+		}
+	}
+
+	suggestions := []string{}
+	for suggestion := range scores {
+		suggestions = append(suggestions, suggestion)
+	}
+	sort.Slice(suggestions, func(i, j int) bool {
+		if scores[suggestions[i]] != scores[suggestions[j]] {
+			return scores[suggestions[i]] > scores[suggestions[j]]
+		}
+		return suggestions[i] < suggestions[j]
+	})
+	if len(suggestions) > limit {
+		suggestions = suggestions[:limit]
+	}
+	return suggestions
+}
+
+// Facets returns up to limit of the most common values of each of the given fields, among the titles that
+// match filters.
+func (m *MemoryTitleModel) Facets(ctx context.Context, filters TitleFilters, fields []string, limit int) (map[string][]FacetCount, error) {
+	return m.CountFacets(ctx, filters, facetLimits(fields, limit))
+}
+
+// CountFacets counts the values of each field in limits among the titles that match filters. limits maps
+// each field to the most values to return for it, or 0 to return all of them.
+func (m *MemoryTitleModel) CountFacets(ctx context.Context, filters TitleFilters, limits map[string]int) (map[string][]FacetCount, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return countFacets(m.matching(filters), limits), nil
+}
+
+// countFacets counts the values of each field in limits among titles, like TitleModel.CountFacets().
+func countFacets(titles []*CatalogTitle, limits map[string]int) map[string][]FacetCount {
+	fields := []string{}
+	for _, field := range FacetFields {
+		if _, ok := limits[field]; ok {
+			fields = append(fields, field)
+		}
+	}
+
+	counter := NewFacetCounter(fields)
+	for _, title := range titles {
+		counter.Add(&title.Title)
+	}
+
+	facets := counter.Result(0)
+	for field, values := range facets {
+		if limit := limits[field]; limit > 0 && len(values) > limit {
+			facets[field] = values[:limit]
+		}
+	}
+	return facets
+}
+
+// Random returns up to count titles that match filters, chosen at random. The same seed returns the same
+// titles, as long as the titles haven't changed.
+func (m *MemoryTitleModel) Random(ctx context.Context, filters TitleFilters, count int, seed int64) ([]*Title, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return randomTitles(m.matching(filters), count, seed), nil
+}
+
+// randomTitles returns copies of up to count of titles, shuffled the same way TitleModel orders its sample:
+// by a hash of their id and the seed.
+func randomTitles(matches []*CatalogTitle, count int, seed int64) []*Title {
+	titles := make([]*Title, 0, len(matches))
+	hashes := make(map[int64]string)
+	for _, title := range matches {
+		titles = append(titles, copyTitle(&title.Title))
+		hashes[title.ID] = fmt.Sprintf("%x", md5.Sum([]byte(strconv.FormatInt(title.ID, 10)+strconv.FormatInt(seed, 10))))
+	}
+	sort.Slice(titles, func(i, j int) bool {
+		return hashes[titles[i].ID] < hashes[titles[j].ID]
+	})
+
+	if len(titles) > count {
+		titles = titles[:count]
+	}
+	return titles
+}
+
+// Similar returns up to limit titles that are most similar to the title with the given id, highest score
+// first, scored the same way as TitleModel.Similar().
+func (m *MemoryTitleModel) Similar(ctx context.Context, id int64, weights SimilarityWeights, limit int) ([]*SimilarTitle, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return similarTitles(m.matching(TitleFilters{}), id, weights, limit), nil
+}
+
+// similarTitles scores every title against the one with the given id, and returns up to limit of the most
+// similar, highest score first. titles must be ordered by id, so that ties are too.
+func similarTitles(titles []*CatalogTitle, id int64, weights SimilarityWeights, limit int) []*SimilarTitle {
+	similar := []*SimilarTitle{}
+	var target *CatalogTitle
+	for _, title := range titles {
+		if title.ID == id {
+			target = title
+			break
+		}
+	}
+	if target == nil {
+		return similar
+	}
+	directors := similarityList(target.Director)
+	countries := similarityList(target.Country)
+	name := trigrams(target.Title.Title)
+	description := trigrams(target.Description)
+
+	for _, title := range titles {
+		if title.ID == id {
+			continue
+		}
+
+		score := 0.0
+		titleDirectors := similarityList(title.Director)
+		for _, director := range directors {
+			if contains(titleDirectors, director) {
+				score += weights.Director
+				break
+			}
+		}
+		titleCountries := similarityList(title.Country)
+		shared := 0
+		for _, country := range countries {
+			if contains(titleCountries, country) {
+				shared++
+			}
+		}
+		score += weights.Country * float64(shared) / math.Max(float64(len(countries)), 1)
+		score += weights.Year * math.Max(0, 1-math.Abs(float64(title.ReleaseYear-target.ReleaseYear))/10)
+		if title.TitleType == target.TitleType {
+			score += weights.TitleType
+		}
+		score += weights.Text * math.Max(
+			trigramSimilarity(trigrams(title.Title.Title), name),
+			trigramSimilarity(trigrams(title.Description), description))
+
+		if score > 0 {
+			similar = append(similar, &SimilarTitle{Title: copyTitle(&title.Title), Score: score})
+		}
+	}
+
+	sort.SliceStable(similar, func(i, j int) bool {
+		return similar[i].Score > similar[j].Score
+	})
+	if len(similar) > limit {
+		similar = similar[:limit]
+	}
+	return similar
+}
+
+// similarityList splits a director or country list into lowercase entries, without the missing values
+// that don't make titles similar.
+func similarityList(s string) []string {
+	entries := []string{}
+	for _, entry := range splitList(strings.ToLower(s)) {
+		if entry != "unknown" {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// contains reports whether list contains s.
+func contains(list []string, s string) bool {
+	for _, entry := range list {
+		if entry == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Ratings returns every maturity rating with its number of titles, most first.
+func (m *MemoryTitleModel) Ratings(ctx context.Context) ([]FacetCount, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	counts := make(map[string]int)
+	for _, title := range m.titles {
+		if title.Rating != "" {
+			counts[title.Rating]++
+		}
+	}
+	m.mu.RUnlock()
+
+	ratings := []FacetCount{}
+	for rating, count := range counts {
+		ratings = append(ratings, FacetCount{Value: rating, Count: count})
+	}
+	sortFacetCounts(ratings)
+	return ratings, nil
+}
+
+// Timeline counts the titles that match filters in each period, the same way as StatsModel.Timeline().
+func (m *MemoryTitleModel) Timeline(ctx context.Context, filters TitleFilters, q TimelineQuery) ([]*TimelineBucket, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return timeline(m.matching(filters), q)
+}
+
+// timeline counts titles in each of q's periods, like TitleModel.Timeline().
+func timeline(titles []*CatalogTitle, q TimelineQuery) ([]*TimelineBucket, error) {
+	counts := make(map[string]map[string]int)
+	groups := make(map[string]bool)
+
+	for _, title := range titles {
+		period := strconv.Itoa(int(title.ReleaseYear))
+		if q.By == ByAddedMonth {
+			if title.DateAdded == nil {
+				continue
+			}
+			period = title.DateAdded.Format(monthLayout)
+		}
+		if (q.From != "" && period < q.From) || (q.To != "" && period > q.To) {
+			continue
+		}
+
+		group := ""
+		if q.Group == "title_type" {
+			group = title.TitleType
+		}
+		if counts[period] == nil {
+			counts[period] = make(map[string]int)
+		}
+		counts[period][group]++
+		groups[group] = true
+	}
+
+	return q.fillBuckets(counts, groups)
+}
+
+// Directors returns a page of directors, the same way as DirectorModel.GetAll().
+func (m *MemoryTitleModel) Directors(ctx context.Context, search string, p Pagination) ([]*Director, Metadata, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	page, metadata := directorPage(m.matching(TitleFilters{}), search, p)
+	return page, metadata, nil
+}
+
+// directorPage counts the titles of each director among titles whose name contains search
+// (case-insensitive), and returns a page of them like TitleModel.Directors().
+func directorPage(titles []*CatalogTitle, search string, p Pagination) ([]*Director, Metadata) {
+	search = strings.ToLower(search)
+
+	// each director is only counted once per title, in case they're listed twice on it
+	counts := make(map[string]int)
+	for _, title := range titles {
+		names := make(map[string]bool)
+		for _, name := range splitList(title.Director) {
+			if !names[name] && strings.Contains(strings.ToLower(name), search) {
+				names[name] = true
+				counts[name]++
+			}
+		}
+	}
+
+	directors := []*Director{}
+	for name, count := range counts {
+		directors = append(directors, &Director{Name: name, TitleCount: count})
+	}
+	sort.Slice(directors, func(i, j int) bool {
+		if directors[i].TitleCount != directors[j].TitleCount {
+			return directors[i].TitleCount > directors[j].TitleCount
+		}
+		return directors[i].Name < directors[j].Name
+	})
+
+	start, end := p.offset(), p.offset()+p.limit()
+	if start > len(directors) {
+		start = len(directors)
+	}
+	if end > len(directors) {
+		end = len(directors)
+	}
+	page := directors[start:end]
+
+	// like TitleModel's count(*) OVER(), there's no total for a page past the last one
+	totalRecords := 0
+	if len(page) > 0 {
+		totalRecords = len(directors)
+	}
+	return page, calculateMetadata(totalRecords, p)
+}
+
+// DirectorTitles returns the titles of the director with the given name (case-insensitive), ordered by
+// release_year. Returns an ErrRecordNotFound error if they haven't directed any titles.
+func (m *MemoryTitleModel) DirectorTitles(ctx context.Context, name string) ([]*Title, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return directorTitles(m.matching(TitleFilters{}), name)
+}
+
+// directorTitles returns copies of the titles that list the director with the given name (case-insensitive),
+// ordered by release_year, then by their order in titles. Returns an ErrRecordNotFound error if there are none.
+func directorTitles(titles []*CatalogTitle, name string) ([]*Title, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+
+	directed := []*Title{}
+	for _, title := range titles {
+		if contains(splitList(strings.ToLower(title.Director)), name) {
+			directed = append(directed, copyTitle(&title.Title))
+		}
+	}
+
+	if len(directed) == 0 {
+		return nil, ErrRecordNotFound
+	}
+	sort.SliceStable(directed, func(i, j int) bool {
+		return directed[i].ReleaseYear < directed[j].ReleaseYear
+	})
+	return directed, nil
+}
+
+// NewImporter starts an import. The titles are stored when it's committed.
+func (m *MemoryTitleModel) NewImporter(ctx context.Context) (TitleImporter, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	i := &memoryImporter{titles: m, showIDs: make(map[string]bool)}
+	for _, title := range m.titles {
+		if title.ShowID != "" {
+			i.showIDs[title.ShowID] = true
+		}
+	}
+	return i, nil
+}
+
+// memoryImporter is MemoryTitleModel's TitleImporter.
+type memoryImporter struct {
+	titles   *MemoryTitleModel
+	showIDs  map[string]bool
+	imported []*CatalogTitle
+}
+
+// Add queues title to be stored. Returns false if its show_id has already been imported.
+func (i *memoryImporter) Add(title *CatalogTitle) (bool, error) {
+	if i.showIDs[title.ShowID] {
+		return false, nil
+	}
+	i.showIDs[title.ShowID] = true
+	i.imported = append(i.imported, title)
+	return true, nil
+}
+
+// Commit stores the queued titles.
+func (i *memoryImporter) Commit() error {
+	i.titles.mu.Lock()
+	defer i.titles.mu.Unlock()
+
+	for _, title := range i.imported {
+		i.titles.saved(copyTitle(&i.titles.add(title).Title))
+	}
+	i.imported = nil
+	return nil
+}
+
+// Close discards the queued titles if they haven't been committed.
+func (i *memoryImporter) Close() {
+	i.imported = nil
+}
+
+// GetCatalog returns every title with its catalog fields, ordered by id.
+func (m *MemoryTitleModel) GetCatalog(ctx context.Context) ([]*CatalogTitle, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	titles := []*CatalogTitle{}
+	for _, title := range m.matching(TitleFilters{}) {
+		c := *title
+		titles = append(titles, &c)
+	}
+	return titles, nil
+}
+
+// Refresh reads the catalog and inserts, updates and deletes the titles returned by fn all at once, the
+// same way as TitleModel.Refresh(). Returns an ErrRecordNotFound error, without changing anything, if an
+// updated title doesn't exist.
+func (m *MemoryTitleModel) Refresh(ctx context.Context, fn RefreshFunc) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	existing := []*CatalogTitle{}
+	for _, title := range m.matching(TitleFilters{}) {
+		c := *title
+		existing = append(existing, &c)
+	}
+	inserted, updated, deleted, err := fn(existing)
+	if err != nil {
+		return err
+	}
+
+	for _, title := range updated {
+		if _, ok := m.titles[title.ID]; !ok {
+			return ErrRecordNotFound
+		}
+	}
+	for _, title := range inserted {
+		title.ID = m.add(title).ID
+		m.saved(&title.Title)
+	}
+	for _, title := range updated {
+		c := *title
+		m.titles[title.ID] = &c
+		m.saved(&title.Title)
+	}
+	for _, id := range deleted {
+		delete(m.titles, id)
+		m.deleted(id)
+	}
+	return nil
+}
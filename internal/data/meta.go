@@ -0,0 +1,75 @@
+package data
+
+import (
+	"context"
+)
+
+// MetaModel lists the values found in the titles table's columns, so clients don't have to hard-code them.
+type MetaModel struct {
+	titles TitleRepository
+}
+
+// TitleTypes returns every title_type in the titles table with its number of titles, most first.
+func (m MetaModel) TitleTypes(ctx context.Context) ([]FacetCount, error) {
+	facets, err := m.titles.CountFacets(ctx, TitleFilters{}, map[string]int{"title_type": 0})
+	if err != nil {
+		return nil, err
+	}
+	return facets["title_type"], nil
+}
+
+// Countries returns every country in the titles table with its number of titles, most first. Titles made
+// in several countries are counted once for each.
+func (m MetaModel) Countries(ctx context.Context) ([]FacetCount, error) {
+	facets, err := m.titles.CountFacets(ctx, TitleFilters{}, map[string]int{"country": 0})
+	if err != nil {
+		return nil, err
+	}
+	return facets["country"], nil
+}
+
+// Ratings returns every maturity rating (e.g. "TV-MA") in the titles table with its number of titles, most
+// first. Titles without a rating aren't counted.
+func (m MetaModel) Ratings(ctx context.Context) ([]FacetCount, error) {
+	return m.titles.Ratings(ctx)
+}
+
+// Ratings counts the titles with each maturity rating for MetaModel.Ratings().
+func (t TitleModel) Ratings(ctx context.Context) ([]FacetCount, error) {
+	query := `
+	SELECT rating, COUNT(*)
+	FROM titles
+	WHERE rating IS NOT NULL AND rating <> ''
+	GROUP BY rating
+	ORDER BY COUNT(*) DESC, rating`
+
+	// derive a context from ctx, with the query timeout as its deadline
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	// release context's resources before Ratings() returns. Otherwise, those resources will be held
+	// until timeout or the parent context is canceled. Prevents memory leaks!
+	defer cancel()
+
+	rows, err := t.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ratings := []FacetCount{}
+	for rows.Next() {
+		var rating FacetCount
+		err := rows.Scan(&rating.Value, &rating.Count)
+		if err != nil {
+			return nil, err
+		}
+		ratings = append(ratings, rating)
+	}
+
+	// confirm there were no errors during the calls to row.Next()
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return ratings, nil
+}
@@ -1,8 +1,13 @@
 package data
 
 import (
+	"context"
 	"database/sql"
 	"errors"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
 )
 
 // make a custom error, returned from Get() when looking up an item that doesn't exist
@@ -10,14 +15,60 @@ var (
 	ErrRecordNotFound = errors.New("record not found")
 )
 
+// Canceled reports whether err was returned because a query was stopped by its context, either because the
+// ctx passed to the model was canceled or because the query timeout passed. The database may report a query
+// it canceled with its own error, rather than the context's error.
+func Canceled(err error) bool {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code.Name() == "query_canceled" {
+		return true
+	}
+	// SQLite reports it as an interrupted query
+	if sqliteCanceled(err) {
+		return true
+	}
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
 // Models wraps all database models, so they can be found in one place
 type Models struct {
-	Titles TitleModel
+	Titles    TitleRepository
+	Stats     StatsModel
+	Directors DirectorModel
+	Meta      MetaModel
+	Jobs      JobModel
+}
+
+// DefaultQueryTimeout is the usual upper bound on how long a single query may take.
+const DefaultQueryTimeout = 3 * time.Second
+
+// NewModels constructs a new Model. Queries that read or write a few rows are canceled after queryTimeout;
+// those that can touch the whole table have longer, fixed timeouts.
+func NewModels(db *sql.DB, queryTimeout time.Duration) Models {
+	titles := TitleModel{DB: db, observers: &[]TitleObserver{}, commitMu: &sync.Mutex{}, timeout: queryTimeout}
+	return newModels(titles, JobModel{DB: db, timeout: queryTimeout})
+}
+
+// NewSQLiteModels constructs a Model for the SQLite database db (see OpenSQLite()), with the same query
+// timeouts as NewModels(). Background jobs need PostgreSQL, so its JobModel isn't available.
+func NewSQLiteModels(db *sql.DB, queryTimeout time.Duration) Models {
+	titles := SQLiteTitleModel{DB: db, observers: &[]TitleObserver{}, commitMu: &sync.Mutex{}, timeout: queryTimeout}
+	return newModels(titles, JobModel{})
+}
+
+// NewMemoryModels constructs a Model that keeps the titles in memory, starting out empty. Background jobs
+// need PostgreSQL, so its JobModel isn't available (see JobModel.Available()).
+func NewMemoryModels() Models {
+	return newModels(NewMemoryTitleModel(), JobModel{})
 }
 
-// NewModels constructs a new Model
-func NewModels(db *sql.DB) Models {
+// newModels constructs the models that are built on top of titles.
+func newModels(titles TitleRepository, jobs JobModel) Models {
 	return Models{
-		Titles: TitleModel{DB: db},
+		Titles:    titles,
+		Stats:     newStatsModel(titles),
+		Directors: DirectorModel{titles: titles},
+		Meta:      MetaModel{titles: titles},
+		Jobs:      jobs,
 	}
 }
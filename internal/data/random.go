@@ -0,0 +1,56 @@
+package data
+
+import (
+	"context"
+	"fmt"
+)
+
+// MaxRandomSeed is the largest seed (and -MaxRandomSeed the smallest) that Random() samples with. Seeds are
+// sent back to clients in JSON, and JavaScript numbers can't hold every integer above 2^53, so a larger
+// seed might not come back the same.
+const MaxRandomSeed = 1 << 53
+
+// Random returns up to count titles sampled at random from the titles that match filters. The same seed
+// returns the same sample, as long as the titles table hasn't changed.
+//
+// The matching titles are ordered by a hash of their id and the seed, which shuffles them the same way for
+// the same seed, and the first count are returned. That sorts every matching title, but in a single round
+// trip, and the catalog only holds a few thousand titles.
+func (t TitleModel) Random(ctx context.Context, filters TitleFilters, count int, seed int64) ([]*Title, error) {
+	// derive a context from ctx, with the query timeout as its deadline
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	// release context's resources before Random() returns. Otherwise, those resources will be held
+	// until timeout or the parent context is canceled. Prevents memory leaks!
+	defer cancel()
+
+	where, args := filters.whereClause([]interface{}{seed, count})
+	query := fmt.Sprintf(`
+	SELECT %s
+	FROM titles
+	%s
+	ORDER BY md5(id::text || $1::text)
+	LIMIT $2`, titleColumns, where)
+
+	rows, err := t.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	titles := []*Title{}
+	for rows.Next() {
+		var title Title
+		err := scanTitle(rows, &title)
+		if err != nil {
+			return nil, err
+		}
+		titles = append(titles, &title)
+	}
+
+	// confirm there were no errors during the calls to row.Next()
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	return titles, nil
+}
@@ -0,0 +1,166 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// RefreshFunc computes the changes that bring the titles table in line with a new snapshot of the dataset,
+// from existing, every title in the table as returned by GetCatalog(). Refresh calls it inside its
+// transaction, so no other write can change the table between reading it and applying the changes.
+type RefreshFunc func(existing []*CatalogTitle) (inserted, updated []*CatalogTitle, deleted []int64, err error)
+
+// queryer runs a query on its own (*sql.DB) or in a transaction (*sql.Tx).
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// GetCatalog returns every title in the titles table, including the columns loaded from the catalog
+// dataset. Titles that weren't imported from the dataset have an empty ShowID.
+func (t TitleModel) GetCatalog(ctx context.Context) ([]*CatalogTitle, error) {
+	// create a context with a 30-second timeout deadline, since every title is read
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	return queryCatalog(ctx, t.DB, nil, nil)
+}
+
+// queryCatalog returns the titles, with their catalog columns, that meet every one of conditions, ordered by
+// id. It's shared by TitleModel and SQLiteTitleModel, whose conditions use their own placeholders.
+func queryCatalog(ctx context.Context, q queryer, conditions []string, args []interface{}) ([]*CatalogTitle, error) {
+	query := fmt.Sprintf(`
+	SELECT %s,
+		COALESCE(show_id, ''), date_added, COALESCE(rating, ''), COALESCE(description, '')
+	FROM titles
+	%s
+	ORDER BY id`, titleColumns, where(conditions))
+
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	titles := []*CatalogTitle{}
+	for rows.Next() {
+		var title CatalogTitle
+		err := scanTitle(rows, &title.Title, &title.ShowID, &title.DateAdded, &title.Rating, &title.Description)
+		if err != nil {
+			return nil, err
+		}
+		titles = append(titles, &title)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return titles, nil
+}
+
+// Refresh reads the catalog and inserts, updates and deletes the titles returned by fn in a single
+// transaction, to bring the titles table in line with a new snapshot of the dataset. The table is locked
+// against other writes (but not reads) first, so fn's changes are based on the rows they're applied to.
+// Updated titles are matched by ID, and their ShowID is set as well, since a title may have been matched by
+// its title, type and release year instead. The inserted titles' IDs are set from the new rows.
+func (t TitleModel) Refresh(ctx context.Context, fn RefreshFunc) error {
+	ctx, cancel := context.WithTimeout(ctx, importTimeout)
+	defer cancel()
+
+	tx, err := t.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	// Rollback() is a no-op once the transaction has been committed
+	defer tx.Rollback()
+
+	// SHARE ROW EXCLUSIVE conflicts with every write, and with itself, so concurrent refreshes take turns
+	_, err = tx.ExecContext(ctx, `LOCK TABLE titles IN SHARE ROW EXCLUSIVE MODE`)
+	if err != nil {
+		return err
+	}
+
+	existing, err := queryCatalog(ctx, tx, nil, nil)
+	if err != nil {
+		return err
+	}
+	inserted, updated, deleted, err := fn(existing)
+	if err != nil {
+		return err
+	}
+
+	if len(inserted) > 0 {
+		stmt, err := tx.PrepareContext(ctx, `
+		INSERT INTO titles (show_id, title_type, title, director, country, release_year, date_added, rating, description)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING id`)
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+
+		for _, title := range inserted {
+			err := stmt.QueryRowContext(ctx, catalogArgs(title)...).Scan(&title.ID)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if len(updated) > 0 {
+		stmt, err := tx.PrepareContext(ctx, `
+		UPDATE titles
+		SET show_id = $1, title_type = $2, title = $3, director = $4, country = $5, release_year = $6,
+			date_added = $7, rating = $8, description = $9
+		WHERE id = $10`)
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+
+		for _, title := range updated {
+			result, err := stmt.ExecContext(ctx, append(catalogArgs(title), title.ID)...)
+			if err != nil {
+				return err
+			}
+			rowsAffected, err := result.RowsAffected()
+			if err != nil {
+				return err
+			}
+			if rowsAffected == 0 {
+				return ErrRecordNotFound
+			}
+		}
+	}
+
+	if len(deleted) > 0 {
+		_, err := tx.ExecContext(ctx, `DELETE FROM titles WHERE id = ANY($1)`, pq.Array(deleted))
+		if err != nil {
+			return err
+		}
+	}
+
+	return commitAndNotify(t.commitMu, tx, func() {
+		for _, title := range inserted {
+			t.saved(&title.Title)
+		}
+		for _, title := range updated {
+			t.saved(&title.Title)
+		}
+		for _, id := range deleted {
+			t.deleted(id)
+		}
+	})
+}
+
+// catalogArgs returns title's values for the show_id, title_type, title, director, country, release_year,
+// date_added, rating and description columns, in that order.
+func catalogArgs(title *CatalogTitle) []interface{} {
+	return []interface{}{
+		nullString(title.ShowID), title.TitleType, title.Title.Title, title.Director, title.Country,
+		title.ReleaseYear, title.DateAdded, nullString(title.Rating), nullString(title.Description),
+	}
+}
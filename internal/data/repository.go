@@ -0,0 +1,46 @@
+package data
+
+import "context"
+
+// TitleRepository stores the titles. TitleModel keeps them in PostgreSQL, SQLiteTitleModel in SQLite, and
+// MemoryTitleModel in memory. They all apply the same filters, return results in the same order and return
+// the same errors, so the handlers work the same way with any of them.
+type TitleRepository interface {
+	// Observe registers o to be notified after each successful write. Observers should be registered at
+	// startup, before the repository is shared between goroutines.
+	Observe(o TitleObserver)
+	// CheckSchema returns an error if the titles can't be stored, e.g. because a migration hasn't been run.
+	CheckSchema(ctx context.Context) error
+
+	Insert(ctx context.Context, title *Title) error
+	InsertMany(ctx context.Context, titles []*Title) error
+	Get(ctx context.Context, id int64, fields Fieldset) (*Title, error)
+	GetMany(ctx context.Context, ids []int64, fields Fieldset) ([]*Title, error)
+	GetAll(ctx context.Context, filters TitleFilters, fields Fieldset) ([]*Title, error)
+	GetAllFunc(ctx context.Context, filters TitleFilters, fields Fieldset, fn func(*Title) error) error
+	Update(ctx context.Context, title *Title) error
+	Delete(ctx context.Context, id int64) error
+	BulkUpdate(ctx context.Context, filters TitleFilters, update TitleUpdate, dryRun bool, expected int) (*BulkResult, error)
+	BulkDelete(ctx context.Context, filters TitleFilters, dryRun bool, expected int) (*BulkResult, error)
+
+	Suggest(ctx context.Context, filters TitleFilters, limit int) ([]string, error)
+	Facets(ctx context.Context, filters TitleFilters, fields []string, limit int) (map[string][]FacetCount, error)
+	CountFacets(ctx context.Context, filters TitleFilters, limits map[string]int) (map[string][]FacetCount, error)
+	Random(ctx context.Context, filters TitleFilters, count int, seed int64) ([]*Title, error)
+	Similar(ctx context.Context, id int64, weights SimilarityWeights, limit int) ([]*SimilarTitle, error)
+	Ratings(ctx context.Context) ([]FacetCount, error)
+	Timeline(ctx context.Context, filters TitleFilters, q TimelineQuery) ([]*TimelineBucket, error)
+	Directors(ctx context.Context, search string, p Pagination) ([]*Director, Metadata, error)
+	DirectorTitles(ctx context.Context, name string) ([]*Title, error)
+
+	NewImporter(ctx context.Context) (TitleImporter, error)
+	GetCatalog(ctx context.Context) ([]*CatalogTitle, error)
+	Refresh(ctx context.Context, fn RefreshFunc) error
+}
+
+// check that every implementation satisfies the interface
+var (
+	_ TitleRepository = TitleModel{}
+	_ TitleRepository = SQLiteTitleModel{}
+	_ TitleRepository = (*MemoryTitleModel)(nil)
+)
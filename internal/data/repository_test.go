@@ -0,0 +1,420 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// TestMemoryTitleModel runs the shared repository tests against MemoryTitleModel. sqlite_test.go runs the
+// same tests against SQLiteTitleModel.
+func TestMemoryTitleModel(t *testing.T) {
+	testRepository(t, func(t *testing.T) TitleRepository {
+		return NewMemoryTitleModel()
+	})
+}
+
+// testRepository runs the behaviour every TitleRepository must share against the repositories returned by
+// newRepo, which must start out empty. Each subtest gets its own repository.
+func testRepository(t *testing.T, newRepo func(t *testing.T) TitleRepository) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, repo TitleRepository)
+	}{
+		{"filters", testRepositoryFilters},
+		{"not found", testRepositoryNotFound},
+		{"get fields", testRepositoryGetFields},
+		{"update", testRepositoryUpdate},
+		{"bulk", testRepositoryBulk},
+		{"import", testRepositoryImport},
+		{"refresh", testRepositoryRefresh},
+		{"observers", testRepositoryObservers},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, newRepo(t))
+		})
+	}
+}
+
+// insertTestTitles inserts a few titles into repo, in order, and returns them with their new ids.
+func insertTestTitles(t *testing.T, repo TitleRepository) []*Title {
+	titles := []*Title{
+		{TitleType: "Movie", Title: "The Dark Knight", Director: "Christopher Nolan", Country: "United States, United Kingdom", ReleaseYear: 2008},
+		{TitleType: "TV Show", Title: "Dark", Director: "Baran bo Odar", Country: "Germany", ReleaseYear: 2017},
+		{TitleType: "Movie", Title: "Dark Waters", Director: "Todd Haynes", Country: "United States", ReleaseYear: 2019},
+		{TitleType: "Movie", Title: "Inception", Director: "Christopher Nolan", Country: "United States, United Kingdom", ReleaseYear: 2010},
+	}
+	for _, title := range titles {
+		err := repo.Insert(context.Background(), title)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return titles
+}
+
+// names returns the names of titles, in order.
+func names(titles []*Title) []string {
+	names := []string{}
+	for _, title := range titles {
+		names = append(names, title.Title)
+	}
+	return names
+}
+
+func testRepositoryFilters(t *testing.T, repo TitleRepository) {
+	insertTestTitles(t, repo)
+
+	tests := []struct {
+		name    string
+		filters TitleFilters
+		want    []string
+	}{
+		{"no filters", TitleFilters{}, []string{"The Dark Knight", "Dark", "Dark Waters", "Inception"}},
+		{"title exact", TitleFilters{Title: "dark", TitleMatch: MatchExact}, []string{"Dark"}},
+		{"title prefix", TitleFilters{Title: "DARK", TitleMatch: MatchPrefix}, []string{"Dark", "Dark Waters"}},
+		{"title contains", TitleFilters{Title: "knight", TitleMatch: MatchContains}, []string{"The Dark Knight"}},
+		{"title fts", TitleFilters{Title: "dark", TitleMatch: MatchFTS}, []string{"The Dark Knight", "Dark", "Dark Waters"}},
+		{"title fts every word", TitleFilters{Title: "knight dark", TitleMatch: MatchFTS}, []string{"The Dark Knight"}},
+		{"title fts no match", TitleFilters{Title: "batman", TitleMatch: MatchFTS}, []string{}},
+		{"director exact", TitleFilters{Director: "christopher nolan", DirectorMatch: MatchExact}, []string{"The Dark Knight", "Inception"}},
+		{"director prefix", TitleFilters{Director: "todd", DirectorMatch: MatchPrefix}, []string{"Dark Waters"}},
+		{"director contains", TitleFilters{Director: "odar", DirectorMatch: MatchContains}, []string{"Dark"}},
+		{"director fts", TitleFilters{Director: "nolan", DirectorMatch: MatchFTS}, []string{"The Dark Knight", "Inception"}},
+		{"country", TitleFilters{Country: "united kingdom"}, []string{"The Dark Knight", "Inception"}},
+		{"title type", TitleFilters{TitleType: "tv show"}, []string{"Dark"}},
+		{"combined", TitleFilters{Title: "dark", TitleMatch: MatchFTS, TitleType: "Movie"}, []string{"The Dark Knight", "Dark Waters"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			titles, err := repo.GetAll(context.Background(), tt.filters, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := names(titles); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func testRepositoryNotFound(t *testing.T, repo TitleRepository) {
+	insertTestTitles(t, repo)
+	ctx := context.Background()
+
+	_, err := repo.Get(ctx, 999, nil)
+	if !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("Get: got error %v; want ErrRecordNotFound", err)
+	}
+	err = repo.Update(ctx, &Title{ID: 999, TitleType: "Movie", Title: "Roma", Director: "Alfonso Cuarón", Country: "Mexico", ReleaseYear: 2018})
+	if !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("Update: got error %v; want ErrRecordNotFound", err)
+	}
+	for _, id := range []int64{0, 999} {
+		err = repo.Delete(ctx, id)
+		if !errors.Is(err, ErrRecordNotFound) {
+			t.Errorf("Delete(%d): got error %v; want ErrRecordNotFound", id, err)
+		}
+	}
+}
+
+func testRepositoryGetFields(t *testing.T, repo TitleRepository) {
+	titles := insertTestTitles(t, repo)
+	ctx := context.Background()
+
+	title, err := repo.Get(ctx, titles[0].ID, Fieldset{"title", "release_year"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Title{Title: "The Dark Knight", ReleaseYear: 2008}
+	if !reflect.DeepEqual(title, want) {
+		t.Errorf("Get: got %+v; want %+v", title, want)
+	}
+
+	// GetMany keeps the requested order, skips missing ids, and always sets the id
+	got, err := repo.GetMany(ctx, []int64{titles[3].ID, 999, titles[1].ID}, Fieldset{"title"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantMany := []*Title{{ID: titles[3].ID, Title: "Inception"}, {ID: titles[1].ID, Title: "Dark"}}
+	if !reflect.DeepEqual(got, wantMany) {
+		t.Errorf("GetMany: got %+v; want %+v", got, wantMany)
+	}
+}
+
+func testRepositoryUpdate(t *testing.T, repo TitleRepository) {
+	titles := insertTestTitles(t, repo)
+	ctx := context.Background()
+
+	updated := *titles[0]
+	updated.Title = "Batman Begins"
+	updated.ReleaseYear = 2005
+	err := repo.Update(ctx, &updated)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	title, err := repo.Get(ctx, titles[0].ID, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(title, &updated) {
+		t.Errorf("got %+v; want %+v", title, &updated)
+	}
+
+	// full text searches see the new title, and not the old one
+	for search, want := range map[string][]string{"knight": {}, "batman": {"Batman Begins"}} {
+		got, err := repo.GetAll(ctx, TitleFilters{Title: search, TitleMatch: MatchFTS}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(names(got), want) {
+			t.Errorf("search %q: got %q; want %q", search, names(got), want)
+		}
+	}
+
+	err = repo.Delete(ctx, titles[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = repo.Get(ctx, titles[0].ID, nil)
+	if !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("after Delete: got error %v; want ErrRecordNotFound", err)
+	}
+}
+
+func testRepositoryBulk(t *testing.T, repo TitleRepository) {
+	insertTestTitles(t, repo)
+	ctx := context.Background()
+
+	nolan := TitleFilters{Director: "Christopher Nolan", DirectorMatch: MatchExact}
+	france := "France"
+	update := TitleUpdate{Country: &france}
+
+	countries := func() []string {
+		titles, err := repo.GetAll(ctx, nolan, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		countries := []string{}
+		for _, title := range titles {
+			countries = append(countries, title.Country)
+		}
+		return countries
+	}
+	before := countries()
+
+	result, err := repo.BulkUpdate(ctx, nolan, update, true, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.DryRun || result.Affected != 2 || !reflect.DeepEqual(names(result.Sample), []string{"The Dark Knight", "Inception"}) {
+		t.Errorf("dry run: got %+v; want 2 affected, with both in the sample", result)
+	}
+	if got := countries(); !reflect.DeepEqual(got, before) {
+		t.Errorf("dry run: got countries %q; want them unchanged", got)
+	}
+
+	_, err = repo.BulkUpdate(ctx, nolan, update, false, 1)
+	if !errors.Is(err, ErrCountMismatch) {
+		t.Errorf("wrong expected count: got error %v; want ErrCountMismatch", err)
+	}
+	if got := countries(); !reflect.DeepEqual(got, before) {
+		t.Errorf("wrong expected count: got countries %q; want them unchanged", got)
+	}
+
+	result, err = repo.BulkUpdate(ctx, nolan, update, false, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Affected != 2 {
+		t.Errorf("got %d affected; want 2", result.Affected)
+	}
+	if got := countries(); !reflect.DeepEqual(got, []string{"France", "France"}) {
+		t.Errorf("got countries %q; want both France", got)
+	}
+
+	shows := TitleFilters{TitleType: "TV Show"}
+	_, err = repo.BulkDelete(ctx, shows, false, 2)
+	if !errors.Is(err, ErrCountMismatch) {
+		t.Errorf("wrong expected count: got error %v; want ErrCountMismatch", err)
+	}
+	_, err = repo.BulkDelete(ctx, shows, false, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	titles, err := repo.GetAll(ctx, TitleFilters{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := names(titles), []string{"The Dark Knight", "Dark Waters", "Inception"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("after BulkDelete: got %q; want %q", got, want)
+	}
+}
+
+// testCatalogTitle returns a catalog title with the given show_id and name.
+func testCatalogTitle(showID, name string) *CatalogTitle {
+	added := time.Date(2021, time.March, 4, 0, 0, 0, 0, time.UTC)
+	return &CatalogTitle{
+		Title:       Title{TitleType: "Movie", Title: name, Director: "Unknown", Country: "Unknown", ReleaseYear: 2020},
+		ShowID:      showID,
+		DateAdded:   &added,
+		Rating:      "PG-13",
+		Description: "A test title.",
+	}
+}
+
+// catalogSummary describes each catalog title by its show_id, name and catalog fields, so catalogs from
+// different repositories can be compared without their ids.
+func catalogSummary(titles []*CatalogTitle) []string {
+	summary := []string{}
+	for _, title := range titles {
+		added := ""
+		if title.DateAdded != nil {
+			added = title.DateAdded.Format("2006-01-02")
+		}
+		summary = append(summary, fmt.Sprintf("%s|%s|%s|%s|%s", title.ShowID, title.Title.Title, added, title.Rating, title.Description))
+	}
+	return summary
+}
+
+func testRepositoryImport(t *testing.T, repo TitleRepository) {
+	ctx := context.Background()
+
+	importer, err := repo.NewImporter(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, title := range []*CatalogTitle{testCatalogTitle("s1", "Roma"), testCatalogTitle("s2", "Okja"), testCatalogTitle("s1", "Roma again")} {
+		added, err := importer.Add(title)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := title.Title.Title != "Roma again"; added != want {
+			t.Errorf("Add(%q): got %t; want %t", title.Title.Title, added, want)
+		}
+	}
+	err = importer.Commit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	importer.Close()
+
+	// a second import skips the show_ids that were already imported
+	importer, err = repo.NewImporter(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer importer.Close()
+	added, err := importer.Add(testCatalogTitle("s2", "Okja"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if added {
+		t.Errorf("Add of an imported show_id: got true; want false")
+	}
+
+	catalog, err := repo.GetCatalog(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"s1|Roma|2021-03-04|PG-13|A test title.", "s2|Okja|2021-03-04|PG-13|A test title."}
+	if got := catalogSummary(catalog); !reflect.DeepEqual(got, want) {
+		t.Errorf("got catalog %q; want %q", got, want)
+	}
+}
+
+func testRepositoryRefresh(t *testing.T, repo TitleRepository) {
+	titles := insertTestTitles(t, repo)
+	ctx := context.Background()
+
+	err := repo.Refresh(ctx, func(existing []*CatalogTitle) ([]*CatalogTitle, []*CatalogTitle, []int64, error) {
+		if got := len(existing); got != len(titles) {
+			t.Errorf("got %d existing titles; want %d", got, len(titles))
+		}
+		// match the first title to a dataset row, and delete the second
+		matched := *existing[0]
+		matched.ShowID = "s7"
+		matched.Rating = "PG-13"
+		return []*CatalogTitle{testCatalogTitle("s9", "Roma")}, []*CatalogTitle{&matched}, []int64{existing[1].ID}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	catalog, err := repo.GetCatalog(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"s7|The Dark Knight||PG-13|", "|Dark Waters|||", "|Inception|||", "s9|Roma|2021-03-04|PG-13|A test title."}
+	if got := catalogSummary(catalog); !reflect.DeepEqual(got, want) {
+		t.Errorf("got catalog %q; want %q", got, want)
+	}
+
+	// updating a title that doesn't exist changes nothing
+	err = repo.Refresh(ctx, func(existing []*CatalogTitle) ([]*CatalogTitle, []*CatalogTitle, []int64, error) {
+		missing := testCatalogTitle("s10", "Okja")
+		missing.ID = 999
+		return []*CatalogTitle{testCatalogTitle("s11", "Mank")}, []*CatalogTitle{missing}, nil, nil
+	})
+	if !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("got error %v; want ErrRecordNotFound", err)
+	}
+	catalog, err = repo.GetCatalog(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := catalogSummary(catalog); !reflect.DeepEqual(got, want) {
+		t.Errorf("after a failed refresh, got catalog %q; want %q", got, want)
+	}
+}
+
+// recorder is a TitleObserver that records the writes it's notified of.
+type recorder struct {
+	events []string
+}
+
+func (r *recorder) TitleSaved(title *Title) {
+	r.events = append(r.events, fmt.Sprintf("saved %s", title.Title))
+}
+
+func (r *recorder) TitleDeleted(id int64) {
+	r.events = append(r.events, fmt.Sprintf("deleted %d", id))
+}
+
+func testRepositoryObservers(t *testing.T, repo TitleRepository) {
+	r := &recorder{}
+	repo.Observe(r)
+	ctx := context.Background()
+
+	title := &Title{TitleType: "Movie", Title: "Roma", Director: "Alfonso Cuarón", Country: "Mexico", ReleaseYear: 2018}
+	err := repo.Insert(ctx, title)
+	if err != nil {
+		t.Fatal(err)
+	}
+	title.Title = "Roma (2018)"
+	err = repo.Update(ctx, title)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// failed writes aren't observed
+	err = repo.Delete(ctx, 999)
+	if !errors.Is(err, ErrRecordNotFound) {
+		t.Fatalf("got error %v; want ErrRecordNotFound", err)
+	}
+	err = repo.Delete(ctx, title.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"saved Roma", "saved Roma (2018)", fmt.Sprintf("deleted %d", title.ID)}
+	if !reflect.DeepEqual(r.events, want) {
+		t.Errorf("got %q; want %q", r.events, want)
+	}
+}
@@ -0,0 +1,67 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// catalogColumns are the columns of the titles table that only the dataset import and refresh read and
+// write (see CatalogTitle).
+var catalogColumns = []string{"show_id", "date_added", "rating", "description"}
+
+// schemaColumns are all the columns of the titles table that the queries in this package select.
+var schemaColumns = append(append([]string{}, TitleFields...), catalogColumns...)
+
+// CheckSchema returns an error if the titles table is missing any of the columns the queries in this package
+// select, e.g. because a migration hasn't been run. Columns the package doesn't know about are ignored, so
+// a migration that adds a column doesn't need a code change to keep reads working.
+func (t TitleModel) CheckSchema(ctx context.Context) error {
+	query := `
+	SELECT column_name
+	FROM information_schema.columns
+	WHERE table_schema = current_schema() AND table_name = 'titles' AND column_name = ANY($1)`
+
+	// derive a context from ctx, with the query timeout as its deadline
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	// release context's resources before CheckSchema() returns. Otherwise, those resources will be held
+	// until timeout or the parent context is canceled. Prevents memory leaks!
+	defer cancel()
+
+	rows, err := t.DB.QueryContext(ctx, query, pq.Array(schemaColumns))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	found := make(map[string]bool)
+	for rows.Next() {
+		var column string
+		err := rows.Scan(&column)
+		if err != nil {
+			return err
+		}
+		found[column] = true
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	return checkColumns(found)
+}
+
+// checkColumns returns an error listing the schemaColumns that aren't in found, the titles table's columns.
+func checkColumns(found map[string]bool) error {
+	missing := []string{}
+	for _, column := range schemaColumns {
+		if !found[column] {
+			missing = append(missing, column)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("titles table is missing columns %s: run the migrations", strings.Join(missing, ", "))
+	}
+	return nil
+}
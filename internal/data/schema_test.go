@@ -0,0 +1,112 @@
+package data
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestCheckColumns(t *testing.T) {
+	all := func() map[string]bool {
+		found := make(map[string]bool)
+		for _, column := range schemaColumns {
+			found[column] = true
+		}
+		return found
+	}
+
+	tests := []struct {
+		name    string
+		found   map[string]bool
+		missing string
+	}{
+		{"every column", all(), ""},
+		{"extra column", func() map[string]bool { f := all(); f["duration"] = true; return f }(), ""},
+		{"missing catalog column", func() map[string]bool { f := all(); delete(f, "rating"); return f }(), "rating"},
+		{"missing title columns", func() map[string]bool { f := all(); delete(f, "id"); delete(f, "country"); return f }(), "id, country"},
+		{"no table", map[string]bool{}, strings.Join(schemaColumns, ", ")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkColumns(tt.found)
+			switch {
+			case tt.missing == "" && err != nil:
+				t.Errorf("got error %q; want nil", err)
+			case tt.missing != "" && err == nil:
+				t.Errorf("got nil; want columns %s missing", tt.missing)
+			case tt.missing != "" && !strings.Contains(err.Error(), "missing columns "+tt.missing+":"):
+				t.Errorf("got error %q; want columns %s missing", err, tt.missing)
+			}
+		})
+	}
+}
+
+var (
+	createTitlesRx = regexp.MustCompile(`(?is)CREATE TABLE IF NOT EXISTS titles \((.*?)\n\);`)
+	addColumnRx    = regexp.MustCompile(`(?i)ALTER TABLE titles ADD COLUMN IF NOT EXISTS (\w+)`)
+)
+
+// migratedColumns returns the columns of the titles table after every up migration in dir has run.
+func migratedColumns(t *testing.T, dir string) []string {
+	files, err := filepath.Glob(filepath.Join(dir, "*.up.sql"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(files)
+
+	columns := []string{}
+	for _, file := range files {
+		sql, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m := createTitlesRx.FindSubmatch(sql); m != nil {
+			for _, line := range strings.Split(string(m[1]), "\n") {
+				fields := strings.Fields(line)
+				if len(fields) == 0 || strings.EqualFold(fields[0], "CONSTRAINT") || strings.EqualFold(fields[0], "CHECK") {
+					continue
+				}
+				columns = append(columns, fields[0])
+			}
+		}
+		for _, m := range addColumnRx.FindAllSubmatch(sql, -1) {
+			columns = append(columns, string(m[1]))
+		}
+	}
+	return columns
+}
+
+func TestMigrationsMatchSchemaColumns(t *testing.T) {
+	for _, dir := range []string{"../../migrations", "../../migrations/sqlite"} {
+		t.Run(dir, func(t *testing.T) {
+			columns := migratedColumns(t, dir)
+			sort.Strings(columns)
+			want := append([]string{}, schemaColumns...)
+			sort.Strings(want)
+
+			if strings.Join(columns, ",") != strings.Join(want, ",") {
+				t.Errorf("titles table has columns %v; the queries select %v", columns, want)
+			}
+		})
+	}
+}
+
+func TestScanTitleMatchesTitleColumns(t *testing.T) {
+	var title Title
+	dest := Fieldset(nil).dest(&title)
+	if got := len(strings.Split(titleColumns, ", ")); got != len(dest) {
+		t.Fatalf("titleColumns has %d columns; scanTitle() scans %d", got, len(dest))
+	}
+	for _, field := range TitleFields {
+		if _, ok := titleFieldValues[field]; !ok {
+			t.Errorf("TitleFields lists %q, which isn't scanned into a Title field", field)
+		}
+	}
+	if len(titleFieldValues) != len(TitleFields) {
+		t.Errorf("titleFieldValues has %d fields; TitleFields has %d", len(titleFieldValues), len(TitleFields))
+	}
+}
@@ -0,0 +1,99 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// SimilarityWeights sets how much each kind of likeness adds to a title's similarity score. Each kind of
+// likeness is scored between 0 and 1 before it's weighted.
+type SimilarityWeights struct {
+	Director  float64 // 1 if the titles share a director
+	Country   float64 // the fraction of the title's countries the other title shares
+	Year      float64 // 1 for the same release_year, falling to 0 for titles 10 or more years apart
+	TitleType float64 // 1 if the titles have the same title_type
+	Text      float64 // the trigram similarity of the titles' names, or descriptions if that's higher
+}
+
+// SimilarTitle is a title with its similarity score to another title.
+type SimilarTitle struct {
+	*Title
+	Score float64 `json:"score"`
+}
+
+// Similar returns up to limit titles that are most similar to the title with the given id, highest score
+// first. Titles that aren't alike in any weighted way aren't returned.
+func (t TitleModel) Similar(ctx context.Context, id int64, weights SimilarityWeights, limit int) ([]*SimilarTitle, error) {
+	// the director and country lists are split into lowercase arrays, so they can be compared by entry.
+	// Missing directors are stored as 'Unknown' (or empty), which doesn't make titles similar
+	query := fmt.Sprintf(`
+	WITH lists AS (
+		SELECT %s, COALESCE(description, '') AS description,
+			ARRAY(
+				SELECT LOWER(TRIM(d)) FROM regexp_split_to_table(director, ',') AS d
+				WHERE TRIM(d) <> '' AND LOWER(TRIM(d)) <> 'unknown'
+			) AS directors,
+			ARRAY(
+				SELECT LOWER(TRIM(c)) FROM regexp_split_to_table(country, ',') AS c
+				WHERE TRIM(c) <> '' AND LOWER(TRIM(c)) <> 'unknown'
+			) AS countries
+		FROM titles
+	), scores AS (
+		SELECT %s,
+			$2::float8 * (c.directors && t.directors)::int
+			+ $3::float8 * (SELECT COUNT(*) FROM unnest(t.countries) AS tc WHERE tc = ANY(c.countries))::float
+				/ GREATEST(cardinality(t.countries), 1)
+			+ $4::float8 * GREATEST(0, 1 - ABS(c.release_year - t.release_year) / 10.0)
+			+ $5::float8 * (c.title_type = t.title_type)::int
+			+ $6::float8 * GREATEST(similarity(c.title, t.title), similarity(c.description, t.description))
+			AS score
+		FROM lists AS c, lists AS t
+		WHERE t.id = $1 AND c.id <> $1
+	)
+	SELECT %s, score
+	FROM scores
+	WHERE score > 0
+	ORDER BY score DESC, id
+	LIMIT $7`, titleColumns, "c."+strings.Join(TitleFields, ", c."), titleColumns)
+
+	args := []interface{}{
+		id,
+		weights.Director,
+		weights.Country,
+		weights.Year,
+		weights.TitleType,
+		weights.Text,
+		limit,
+	}
+
+	// derive a context from ctx, with the query timeout as its deadline
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	// release context's resources before Similar() returns. Otherwise, those resources will be held
+	// until timeout or the parent context is canceled. Prevents memory leaks!
+	defer cancel()
+
+	rows, err := t.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	similar := []*SimilarTitle{}
+	for rows.Next() {
+		title := SimilarTitle{Title: &Title{}}
+		err := scanTitle(rows, title.Title, &title.Score)
+		if err != nil {
+			return nil, err
+		}
+		similar = append(similar, &title)
+	}
+
+	// confirm there were no errors during the calls to row.Next()
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return similar, nil
+}
@@ -0,0 +1,1109 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SQLiteTitleModel is a TitleRepository that keeps the titles in a SQLite database, so the API can run on a
+// laptop or in CI without PostgreSQL. Its schema is created by the migrations in migrations/sqlite.
+//
+// Full text searches use the titles_fts FTS5 table in place of PostgreSQL's tsvector indexes, so the API
+// must be built with -tags sqlite_fts5, which also builds in the SQLite driver (see sqlite_fts5.go). SQLite
+// has no pg_trgm, regexp_split_to_table() or md5(), so Suggest, Similar, Random, CountFacets and the
+// directors read the matching rows and finish the work in Go, the same way as MemoryTitleModel. Everything
+// else is done in SQL, like TitleModel.
+type SQLiteTitleModel struct {
+	DB        *sql.DB
+	observers *[]TitleObserver
+	commitMu  *sync.Mutex
+	timeout   time.Duration
+}
+
+// IsSQLiteDSN reports whether dsn names a SQLite database rather than a PostgreSQL one: a sqlite3:// or
+// sqlite:// URL (e.g. sqlite3://netflix.db, as the migrate CLI takes it), or a file: URI.
+func IsSQLiteDSN(dsn string) bool {
+	for _, scheme := range []string{"sqlite3://", "sqlite://", "file:"} {
+		if strings.HasPrefix(dsn, scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+// OpenSQLite opens the SQLite database named by dsn (see IsSQLiteDSN). Only one connection can write at a
+// time, so each transaction takes the write lock when it begins, and waits up to 5 seconds for it rather
+// than failing at once. The WAL journal lets reads carry on during a write. Returns an error if the binary
+// was built without the SQLite driver.
+func OpenSQLite(dsn string) (*sql.DB, error) {
+	if !sqliteDriverRegistered() {
+		return nil, errors.New("SQLite isn't supported by this build, rebuild it with -tags sqlite_fts5")
+	}
+
+	for _, scheme := range []string{"sqlite3://", "sqlite://"} {
+		dsn = strings.TrimPrefix(dsn, scheme)
+	}
+	if !strings.HasPrefix(dsn, "file:") {
+		dsn = "file:" + dsn
+	}
+
+	sep := "?"
+	if strings.Contains(dsn, "?") {
+		sep = "&"
+	}
+	return sql.Open("sqlite3", dsn+sep+"_txlock=immediate&_busy_timeout=5000&_journal_mode=WAL")
+}
+
+// sqliteDriverRegistered reports whether the sqlite3 database/sql driver was built in.
+func sqliteDriverRegistered() bool {
+	for _, driver := range sql.Drivers() {
+		if driver == "sqlite3" {
+			return true
+		}
+	}
+	return false
+}
+
+// Observe registers o to be notified after each successful write. The observers are notified in the order
+// the writes were committed, like TitleModel's (see commitAndNotify()).
+func (s SQLiteTitleModel) Observe(o TitleObserver) {
+	*s.observers = append(*s.observers, o)
+}
+
+// saved notifies the observers that title was inserted or updated.
+func (s SQLiteTitleModel) saved(title *Title) {
+	for _, o := range *s.observers {
+		o.TitleSaved(title)
+	}
+}
+
+// deleted notifies the observers that the title with the given id was deleted.
+func (s SQLiteTitleModel) deleted(id int64) {
+	for _, o := range *s.observers {
+		o.TitleDeleted(id)
+	}
+}
+
+// sqliteConditions returns one SQL condition per non-empty filter, like TitleFilters.conditions(), with
+// SQLite's numbered ?NNN placeholders.
+func (f TitleFilters) sqliteConditions(args []interface{}) ([]string, []interface{}) {
+	conditions := []string{}
+
+	if f.Title != "" {
+		var condition string
+		condition, args = sqliteMatchCondition("title", f.TitleMatch, f.Title, args)
+		conditions = append(conditions, condition)
+	}
+	if f.Country != "" {
+		var condition string
+		condition, args = ftsCondition("country", f.Country, args)
+		conditions = append(conditions, condition)
+	}
+	if f.TitleType != "" {
+		args = append(args, f.TitleType)
+		conditions = append(conditions, fmt.Sprintf("LOWER(title_type) = LOWER(?%d)", len(args)))
+	}
+	if f.Director != "" {
+		var condition string
+		condition, args = sqliteMatchCondition("director", f.DirectorMatch, f.Director, args)
+		conditions = append(conditions, condition)
+	}
+
+	return conditions, args
+}
+
+// sqliteWhereClause builds a SQL WHERE clause from the non-empty filters, like TitleFilters.whereClause().
+func (f TitleFilters) sqliteWhereClause(args []interface{}) (string, []interface{}) {
+	conditions, args := f.sqliteConditions(args)
+	return where(conditions), args
+}
+
+// sqliteMatchCondition returns the SQLite condition that compares column against value using the given
+// match mode, like matchCondition().
+func sqliteMatchCondition(column, mode, value string, args []interface{}) (string, []interface{}) {
+	switch mode {
+	case MatchPrefix:
+		args = append(args, escapeLike(strings.ToLower(value))+"%")
+		return fmt.Sprintf(`LOWER(%s) LIKE ?%d ESCAPE '\'`, column, len(args)), args
+	case MatchContains:
+		args = append(args, "%"+escapeLike(strings.ToLower(value))+"%")
+		return fmt.Sprintf(`LOWER(%s) LIKE ?%d ESCAPE '\'`, column, len(args)), args
+	case MatchFTS:
+		return ftsCondition(column, value, args)
+	default:
+		args = append(args, value)
+		return fmt.Sprintf("LOWER(%s) = LOWER(?%d)", column, len(args)), args
+	}
+}
+
+// ftsCondition returns the condition that searches column in the titles_fts index for every word in value,
+// like plainto_tsquery('simple', value) does. A value without any words matches nothing.
+func ftsCondition(column, value string, args []interface{}) (string, []interface{}) {
+	words := Tokenize(value)
+	if len(words) == 0 {
+		return "FALSE", args
+	}
+
+	// each word is quoted, so it can't be read as an FTS5 operator like OR or NOT
+	phrases := make([]string, len(words))
+	for i, word := range words {
+		phrases[i] = fmt.Sprintf(`%s : "%s"`, column, word)
+	}
+	args = append(args, strings.Join(phrases, " AND "))
+	return fmt.Sprintf("id IN (SELECT rowid FROM titles_fts WHERE titles_fts MATCH ?%d)", len(args)), args
+}
+
+// sqliteDate converts a date to its YYYY-MM-DD text, or a nil date to a SQL NULL.
+func sqliteDate(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+	return t.Format("2006-01-02")
+}
+
+// sqliteCatalogArgs returns the same values as catalogArgs(), with date_added as text.
+func sqliteCatalogArgs(title *CatalogTitle) []interface{} {
+	args := catalogArgs(title)
+	args[6] = sqliteDate(title.DateAdded)
+	return args
+}
+
+// sqliteIDs converts ids to a JSON array, for json_each(), which stands in for PostgreSQL's = ANY($1).
+func sqliteIDs(ids []int64) (string, error) {
+	js, err := json.Marshal(ids)
+	return string(js), err
+}
+
+// CheckSchema returns an error if the titles table is missing any of the columns the queries select, or the
+// titles_fts index can't be read, e.g. because a migration hasn't been run.
+func (s SQLiteTitleModel) CheckSchema(ctx context.Context) error {
+	// derive a context from ctx, with the query timeout as its deadline
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	// release context's resources before CheckSchema() returns. Otherwise, those resources will be held
+	// until timeout or the parent context is canceled. Prevents memory leaks!
+	defer cancel()
+
+	rows, err := s.DB.QueryContext(ctx, `SELECT name FROM pragma_table_info('titles')`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	found := make(map[string]bool)
+	for rows.Next() {
+		var column string
+		err := rows.Scan(&column)
+		if err != nil {
+			return err
+		}
+		found[column] = true
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	err = checkColumns(found)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.DB.ExecContext(ctx, `SELECT rowid FROM titles_fts LIMIT 0`)
+	if err != nil {
+		if strings.Contains(err.Error(), "no such module: fts5") {
+			return errors.New("titles_fts needs SQLite's FTS5 extension: build with -tags sqlite_fts5")
+		}
+		return fmt.Errorf("titles_fts can't be read (%v): run the migrations", err)
+	}
+	return nil
+}
+
+// Insert inserts a new row into the titles table, and sets title.ID.
+func (s SQLiteTitleModel) Insert(ctx context.Context, title *Title) error {
+	query := `
+	INSERT INTO titles (title_type, title, director, country, release_year)
+	VALUES (?1, ?2, ?3, ?4, ?5)
+	RETURNING id`
+
+	args := []interface{}{title.TitleType, title.Title, title.Director, title.Country, title.ReleaseYear}
+
+	// derive a context from ctx, with the query timeout as its deadline
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	// release context's resources before Insert() returns. Otherwise, those resources will be held
+	// until timeout or the parent context is canceled. Prevents memory leaks!
+	defer cancel()
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	// Rollback() is a no-op once the transaction has been committed
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&title.ID)
+	if err != nil {
+		return err
+	}
+
+	return commitAndNotify(s.commitMu, tx, func() {
+		s.saved(title)
+	})
+}
+
+// InsertMany inserts titles in a single transaction, like TitleModel.InsertMany().
+func (s SQLiteTitleModel) InsertMany(ctx context.Context, titles []*Title) error {
+	query := `
+	INSERT INTO titles (title_type, title, director, country, release_year)
+	VALUES (?1, ?2, ?3, ?4, ?5)
+	RETURNING id`
+
+	// derive a context from ctx, with the query timeout as its deadline
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	// release context's resources before InsertMany() returns. Otherwise, those resources will be held
+	// until timeout or the parent context is canceled. Prevents memory leaks!
+	defer cancel()
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	// Rollback() is a no-op once the transaction has been committed
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, title := range titles {
+		args := []interface{}{title.TitleType, title.Title, title.Director, title.Country, title.ReleaseYear}
+		err := stmt.QueryRowContext(ctx, args...).Scan(&title.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return commitAndNotify(s.commitMu, tx, func() {
+		for _, title := range titles {
+			s.saved(title)
+		}
+	})
+}
+
+// Get returns the title with the given id, with only the columns in fields selected, or every column if
+// fields is empty. Returns an ErrRecordNotFound error if there's no such title.
+func (s SQLiteTitleModel) Get(ctx context.Context, id int64, fields Fieldset) (*Title, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	query := fmt.Sprintf(`
+	SELECT %s
+	FROM titles
+	WHERE id = ?1`, fields.columns())
+
+	var title Title
+
+	// derive a context from ctx, with the query timeout as its deadline
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	// release context's resources before Get() returns. Otherwise, those resources will be held
+	// until timeout or the parent context is canceled. Prevents memory leaks!
+	defer cancel()
+
+	err := s.DB.QueryRowContext(ctx, query, id).Scan(fields.dest(&title)...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &title, nil
+}
+
+// GetMany returns the titles with the given ids in a single query, in the same order as ids. Ids that don't
+// exist are skipped. Only the columns in fields are selected, along with id.
+func (s SQLiteTitleModel) GetMany(ctx context.Context, ids []int64, fields Fieldset) ([]*Title, error) {
+	// the id column is always selected, to put the titles back in the requested order
+	fields = fields.withID()
+
+	query := fmt.Sprintf(`
+	SELECT %s
+	FROM titles
+	WHERE id IN (SELECT value FROM json_each(?1))`, fields.columns())
+
+	list, err := sqliteIDs(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	// derive a context from ctx, with the query timeout as its deadline
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	// release context's resources before GetMany() returns. Otherwise, those resources will be held
+	// until timeout or the parent context is canceled. Prevents memory leaks!
+	defer cancel()
+
+	rows, err := s.DB.QueryContext(ctx, query, list)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	found := make(map[int64]*Title)
+	for rows.Next() {
+		var title Title
+		err := rows.Scan(fields.dest(&title)...)
+		if err != nil {
+			return nil, err
+		}
+		found[title.ID] = &title
+	}
+
+	// confirm there were no errors during the calls to row.Next()
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	// put the titles back in the requested order
+	titles := []*Title{}
+	for _, id := range ids {
+		if title, ok := found[id]; ok {
+			titles = append(titles, title)
+		}
+	}
+	return titles, nil
+}
+
+// GetAll returns the titles that match filters, ordered by id, with only the columns in fields selected.
+func (s SQLiteTitleModel) GetAll(ctx context.Context, filters TitleFilters, fields Fieldset) ([]*Title, error) {
+	// derive a context from ctx, with the query timeout as its deadline
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	// release context's resources before GetAll() returns. Otherwise, those resources will be held
+	// until timeout or the parent context is canceled. Prevents memory leaks!
+	defer cancel()
+
+	titles := []*Title{}
+	err := s.each(ctx, filters, fields, func(title *Title) error {
+		titles = append(titles, title)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return titles, nil
+}
+
+// GetAllFunc calls fn with each title that GetAll() would return, in the same order, as each row is scanned.
+// If fn returns an error, no more rows are read and the error is returned.
+func (s SQLiteTitleModel) GetAllFunc(ctx context.Context, filters TitleFilters, fields Fieldset, fn func(*Title) error) error {
+	ctx, cancel := context.WithTimeout(ctx, streamTimeout)
+	defer cancel()
+
+	return s.each(ctx, filters, fields, fn)
+}
+
+// each runs the query for GetAll() and GetAllFunc(), and calls fn with each scanned title.
+func (s SQLiteTitleModel) each(ctx context.Context, filters TitleFilters, fields Fieldset, fn func(*Title) error) error {
+	where, args := filters.sqliteWhereClause(nil)
+	query := fmt.Sprintf(`
+	SELECT %s
+	FROM titles
+	%s
+	ORDER BY id`, fields.columns(), where)
+
+	rows, err := s.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var title Title
+		err := rows.Scan(fields.dest(&title)...)
+		if err != nil {
+			return err
+		}
+		err = fn(&title)
+		if err != nil {
+			return err
+		}
+	}
+
+	// confirm there were no errors during the calls to row.Next()
+	return rows.Err()
+}
+
+// catalog returns the titles, with their catalog columns, that meet every one of conditions, ordered by id.
+// It reads the rows for the methods that finish their work in Go.
+func (s SQLiteTitleModel) catalog(ctx context.Context, conditions []string, args []interface{}) ([]*CatalogTitle, error) {
+	return queryCatalog(ctx, s.DB, conditions, args)
+}
+
+// Update replaces the title with title.ID by title, and reads the updated row back into title. Returns an
+// ErrRecordNotFound error if there's no such title.
+func (s SQLiteTitleModel) Update(ctx context.Context, title *Title) error {
+	query := fmt.Sprintf(`
+	UPDATE titles
+	SET title_type = ?1, title = ?2, director = ?3, country = ?4, release_year = ?5
+	WHERE id = ?6
+	RETURNING %s`, titleColumns)
+
+	args := []interface{}{
+		title.TitleType,
+		title.Title,
+		title.Director,
+		title.Country,
+		title.ReleaseYear,
+		title.ID,
+	}
+
+	// derive a context from ctx, with the query timeout as its deadline
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	// release context's resources before Update() returns. Otherwise, those resources will be held
+	// until timeout or the parent context is canceled. Prevents memory leaks!
+	defer cancel()
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	// Rollback() is a no-op once the transaction has been committed
+	defer tx.Rollback()
+
+	err = scanTitle(tx.QueryRowContext(ctx, query, args...), title)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	return commitAndNotify(s.commitMu, tx, func() {
+		s.saved(title)
+	})
+}
+
+// Delete deletes the title with the given id. Returns an ErrRecordNotFound error if there's no such title.
+func (s SQLiteTitleModel) Delete(ctx context.Context, id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	// derive a context from ctx, with the query timeout as its deadline
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	// release context's resources before Delete() returns. Otherwise, those resources will be held
+	// until timeout or the parent context is canceled. Prevents memory leaks!
+	defer cancel()
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	// Rollback() is a no-op once the transaction has been committed
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `DELETE FROM titles WHERE id = ?1`, id)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return commitAndNotify(s.commitMu, tx, func() {
+		s.deleted(id)
+	})
+}
+
+// BulkUpdate sets the fields in update on every title that matches filters, the same way as
+// TitleModel.BulkUpdate().
+func (s SQLiteTitleModel) BulkUpdate(ctx context.Context, filters TitleFilters, update TitleUpdate, dryRun bool, expected int) (*BulkResult, error) {
+	set := []string{}
+	args := []interface{}{}
+	for _, field := range []struct {
+		column string
+		value  interface{}
+		ok     bool
+	}{
+		{"title_type", update.TitleType, update.TitleType != nil},
+		{"title", update.Title, update.Title != nil},
+		{"director", update.Director, update.Director != nil},
+		{"country", update.Country, update.Country != nil},
+		{"release_year", update.ReleaseYear, update.ReleaseYear != nil},
+	} {
+		if field.ok {
+			args = append(args, field.value)
+			set = append(set, fmt.Sprintf("%s = ?%d", field.column, len(args)))
+		}
+	}
+	where, args := filters.sqliteWhereClause(args)
+
+	query := fmt.Sprintf(`
+	UPDATE titles
+	SET %s
+	%s
+	RETURNING %s`, strings.Join(set, ", "), where, titleColumns)
+
+	return s.bulk(ctx, filters, dryRun, expected, func(ctx context.Context, tx *sql.Tx) ([]int64, []*Title, error) {
+		rows, err := tx.QueryContext(ctx, query, args...)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer rows.Close()
+
+		titles := []*Title{}
+		for rows.Next() {
+			var title Title
+			err := scanTitle(rows, &title)
+			if err != nil {
+				return nil, nil, err
+			}
+			titles = append(titles, &title)
+		}
+		return nil, titles, rows.Err()
+	})
+}
+
+// BulkDelete deletes every title that matches filters, the same way as TitleModel.BulkDelete().
+func (s SQLiteTitleModel) BulkDelete(ctx context.Context, filters TitleFilters, dryRun bool, expected int) (*BulkResult, error) {
+	where, args := filters.sqliteWhereClause(nil)
+	query := fmt.Sprintf(`
+	DELETE FROM titles
+	%s
+	RETURNING id`, where)
+
+	return s.bulk(ctx, filters, dryRun, expected, func(ctx context.Context, tx *sql.Tx) ([]int64, []*Title, error) {
+		rows, err := tx.QueryContext(ctx, query, args...)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer rows.Close()
+
+		ids := []int64{}
+		for rows.Next() {
+			var id int64
+			err := rows.Scan(&id)
+			if err != nil {
+				return nil, nil, err
+			}
+			ids = append(ids, id)
+		}
+		return ids, nil, rows.Err()
+	})
+}
+
+// bulk runs a bulk operation in a transaction, like TitleModel.bulk(). There's no SELECT ... FOR UPDATE in
+// SQLite, but the transaction holds the database's write lock from the start (see OpenSQLite()), so the
+// count can't change before the operation runs.
+func (s SQLiteTitleModel) bulk(ctx context.Context, filters TitleFilters, dryRun bool, expected int, exec func(ctx context.Context, tx *sql.Tx) ([]int64, []*Title, error)) (*BulkResult, error) {
+	// bulk operations can touch the whole table, so they get more time than a single query
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	// Rollback() is a no-op once the transaction has been committed
+	defer tx.Rollback()
+
+	where, args := filters.sqliteWhereClause(nil)
+	query := fmt.Sprintf(`
+	SELECT %s
+	FROM titles
+	%s
+	ORDER BY id`, titleColumns, where)
+
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := &BulkResult{DryRun: dryRun, Sample: []*Title{}}
+	for rows.Next() {
+		var title Title
+		err := scanTitle(rows, &title)
+		if err != nil {
+			return nil, err
+		}
+		result.Affected++
+		if len(result.Sample) < maxBulkSample {
+			result.Sample = append(result.Sample, &title)
+		}
+	}
+
+	// confirm there were no errors during the calls to row.Next()
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	if dryRun {
+		return result, nil
+	}
+	if result.Affected != expected {
+		return nil, ErrCountMismatch
+	}
+
+	deleted, saved, err := exec(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+	// the write lock should make this impossible, but check the operation's count the same way as PostgreSQL
+	if len(deleted)+len(saved) != expected {
+		return nil, ErrCountMismatch
+	}
+
+	err = commitAndNotify(s.commitMu, tx, func() {
+		for _, id := range deleted {
+			s.deleted(id)
+		}
+		for _, title := range saved {
+			s.saved(title)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Suggest returns up to limit distinct titles that are spelled similarly to filters.Title, closest first,
+// among the titles that match the other filters. Similarity is approximated in Go (see trigram.go).
+func (s SQLiteTitleModel) Suggest(ctx context.Context, filters TitleFilters, limit int) ([]string, error) {
+	term := filters.Title
+	filters.Title = ""
+
+	// derive a context from ctx, with the query timeout as its deadline
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	// release context's resources before Suggest() returns. Otherwise, those resources will be held
+	// until timeout or the parent context is canceled. Prevents memory leaks!
+	defer cancel()
+
+	conditions, args := filters.sqliteConditions(nil)
+	titles, err := s.catalog(ctx, conditions, args)
+	if err != nil {
+		return nil, err
+	}
+	return suggestTitles(titles, term, limit), nil
+}
+
+// Facets returns up to limit of the most common values of each of the given fields, among the titles that
+// match filters.
+func (s SQLiteTitleModel) Facets(ctx context.Context, filters TitleFilters, fields []string, limit int) (map[string][]FacetCount, error) {
+	return s.CountFacets(ctx, filters, facetLimits(fields, limit))
+}
+
+// CountFacets counts the values of each field in limits among the titles that match filters. limits maps
+// each field to the most values to return for it, or 0 to return all of them.
+func (s SQLiteTitleModel) CountFacets(ctx context.Context, filters TitleFilters, limits map[string]int) (map[string][]FacetCount, error) {
+	if len(limits) == 0 {
+		return make(map[string][]FacetCount), nil
+	}
+
+	// derive a context from ctx, with the query timeout as its deadline
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	// release context's resources before CountFacets() returns. Otherwise, those resources will be held
+	// until timeout or the parent context is canceled. Prevents memory leaks!
+	defer cancel()
+
+	conditions, args := filters.sqliteConditions(nil)
+	titles, err := s.catalog(ctx, conditions, args)
+	if err != nil {
+		return nil, err
+	}
+	return countFacets(titles, limits), nil
+}
+
+// Random returns up to count titles that match filters, chosen at random. The same seed returns the same
+// titles, as long as the titles haven't changed.
+func (s SQLiteTitleModel) Random(ctx context.Context, filters TitleFilters, count int, seed int64) ([]*Title, error) {
+	// derive a context from ctx, with the query timeout as its deadline
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	// release context's resources before Random() returns. Otherwise, those resources will be held
+	// until timeout or the parent context is canceled. Prevents memory leaks!
+	defer cancel()
+
+	conditions, args := filters.sqliteConditions(nil)
+	titles, err := s.catalog(ctx, conditions, args)
+	if err != nil {
+		return nil, err
+	}
+	return randomTitles(titles, count, seed), nil
+}
+
+// Similar returns up to limit titles that are most similar to the title with the given id, highest score
+// first, scored the same way as TitleModel.Similar().
+func (s SQLiteTitleModel) Similar(ctx context.Context, id int64, weights SimilarityWeights, limit int) ([]*SimilarTitle, error) {
+	// derive a context from ctx, with the query timeout as its deadline
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	// release context's resources before Similar() returns. Otherwise, those resources will be held
+	// until timeout or the parent context is canceled. Prevents memory leaks!
+	defer cancel()
+
+	titles, err := s.catalog(ctx, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return similarTitles(titles, id, weights, limit), nil
+}
+
+// Ratings returns every maturity rating with its number of titles, most first.
+func (s SQLiteTitleModel) Ratings(ctx context.Context) ([]FacetCount, error) {
+	query := `
+	SELECT rating, COUNT(*)
+	FROM titles
+	WHERE rating IS NOT NULL AND rating <> ''
+	GROUP BY rating
+	ORDER BY COUNT(*) DESC, rating`
+
+	// derive a context from ctx, with the query timeout as its deadline
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	// release context's resources before Ratings() returns. Otherwise, those resources will be held
+	// until timeout or the parent context is canceled. Prevents memory leaks!
+	defer cancel()
+
+	rows, err := s.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ratings := []FacetCount{}
+	for rows.Next() {
+		var rating FacetCount
+		err := rows.Scan(&rating.Value, &rating.Count)
+		if err != nil {
+			return nil, err
+		}
+		ratings = append(ratings, rating)
+	}
+
+	// confirm there were no errors during the calls to row.Next()
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return ratings, nil
+}
+
+// Timeline counts the matching titles in each period for StatsModel.Timeline().
+func (s SQLiteTitleModel) Timeline(ctx context.Context, filters TitleFilters, q TimelineQuery) ([]*TimelineBucket, error) {
+	conditions, args := filters.sqliteConditions(nil)
+
+	// the period each title falls in, formatted the same way as formatPeriod()
+	period := "CAST(release_year AS text)"
+	if q.By == ByAddedMonth {
+		period = "strftime('%Y-%m', date_added)"
+		conditions = append(conditions, "date_added IS NOT NULL")
+	}
+	if q.From != "" {
+		args = append(args, q.From)
+		conditions = append(conditions, fmt.Sprintf("%s >= ?%d", period, len(args)))
+	}
+	if q.To != "" {
+		args = append(args, q.To)
+		conditions = append(conditions, fmt.Sprintf("%s <= ?%d", period, len(args)))
+	}
+
+	group := "''"
+	if q.Group != "" {
+		group = q.Group
+	}
+
+	query := fmt.Sprintf(`
+	SELECT %s AS period, %s AS grp, COUNT(*)
+	FROM titles
+	%s
+	GROUP BY 1, 2`, period, group, where(conditions))
+
+	// derive a context from ctx, with the query timeout as its deadline
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	// release context's resources before Timeline() returns. Otherwise, those resources will be held
+	// until timeout or the parent context is canceled. Prevents memory leaks!
+	defer cancel()
+
+	rows, err := s.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[string]map[string]int)
+	groups := make(map[string]bool)
+	for rows.Next() {
+		var period, group string
+		var count int
+		err := rows.Scan(&period, &group, &count)
+		if err != nil {
+			return nil, err
+		}
+		if counts[period] == nil {
+			counts[period] = make(map[string]int)
+		}
+		counts[period][group] = count
+		groups[group] = true
+	}
+
+	// confirm there were no errors during the calls to row.Next()
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return q.fillBuckets(counts, groups)
+}
+
+// Directors returns a page of directors for DirectorModel.GetAll().
+func (s SQLiteTitleModel) Directors(ctx context.Context, search string, p Pagination) ([]*Director, Metadata, error) {
+	// the LIKE condition skips the titles without a matching director, then the names in each director
+	// list are counted in Go
+	conditions := []string{`LOWER(director) LIKE ?1 ESCAPE '\'`}
+	args := []interface{}{"%" + escapeLike(strings.ToLower(search)) + "%"}
+
+	// derive a context from ctx, with the query timeout as its deadline
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	// release context's resources before Directors() returns. Otherwise, those resources will be held
+	// until timeout or the parent context is canceled. Prevents memory leaks!
+	defer cancel()
+
+	titles, err := s.catalog(ctx, conditions, args)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	page, metadata := directorPage(titles, search, p)
+	return page, metadata, nil
+}
+
+// DirectorTitles returns a director's titles for DirectorModel.GetTitles().
+func (s SQLiteTitleModel) DirectorTitles(ctx context.Context, name string) ([]*Title, error) {
+	conditions := []string{`LOWER(director) LIKE ?1 ESCAPE '\'`}
+	args := []interface{}{"%" + escapeLike(strings.ToLower(strings.TrimSpace(name))) + "%"}
+
+	// derive a context from ctx, with the query timeout as its deadline
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	// release context's resources before DirectorTitles() returns. Otherwise, those resources will be held
+	// until timeout or the parent context is canceled. Prevents memory leaks!
+	defer cancel()
+
+	titles, err := s.catalog(ctx, conditions, args)
+	if err != nil {
+		return nil, err
+	}
+	return directorTitles(titles, name)
+}
+
+// sqliteImporter is SQLiteTitleModel's TitleImporter. Each title is inserted as it's added, in a single
+// transaction.
+type sqliteImporter struct {
+	titles   SQLiteTitleModel
+	ctx      context.Context
+	cancel   context.CancelFunc
+	tx       *sql.Tx
+	stmt     *sql.Stmt
+	showIDs  map[string]bool
+	imported []*CatalogTitle
+}
+
+// NewImporter starts an import into the titles table.
+func (s SQLiteTitleModel) NewImporter(ctx context.Context) (TitleImporter, error) {
+	ctx, cancel := context.WithTimeout(ctx, importTimeout)
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	i := &sqliteImporter{titles: s, ctx: ctx, cancel: cancel, tx: tx, showIDs: make(map[string]bool)}
+
+	// read the existing show ids first, like copyImporter. Skipping a conflicting row with ON CONFLICT
+	// would still use up an id
+	rows, err := tx.QueryContext(ctx, `SELECT show_id FROM titles WHERE show_id IS NOT NULL`)
+	if err != nil {
+		i.Close()
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var showID string
+		err := rows.Scan(&showID)
+		if err != nil {
+			i.Close()
+			return nil, err
+		}
+		i.showIDs[showID] = true
+	}
+	err = rows.Err()
+	if err != nil {
+		i.Close()
+		return nil, err
+	}
+
+	i.stmt, err = tx.PrepareContext(ctx, `
+	INSERT INTO titles (show_id, title_type, title, director, country, release_year, date_added, rating, description)
+	VALUES (?1, ?2, ?3, ?4, ?5, ?6, ?7, ?8, ?9)
+	RETURNING id`)
+	if err != nil {
+		i.Close()
+		return nil, err
+	}
+
+	return i, nil
+}
+
+// Add inserts title. Returns false if the title was skipped because its show_id has already been imported.
+func (i *sqliteImporter) Add(title *CatalogTitle) (bool, error) {
+	if i.showIDs[title.ShowID] {
+		return false, nil
+	}
+
+	err := i.stmt.QueryRowContext(i.ctx, sqliteCatalogArgs(title)...).Scan(&title.ID)
+	if err != nil {
+		return false, err
+	}
+
+	i.showIDs[title.ShowID] = true
+	i.imported = append(i.imported, title)
+	return true, nil
+}
+
+// Commit commits the import, and notifies the SQLiteTitleModel's observers of the imported titles.
+func (i *sqliteImporter) Commit() error {
+	err := i.stmt.Close()
+	if err != nil {
+		return err
+	}
+	imported := i.imported
+	i.imported = nil
+	return commitAndNotify(i.titles.commitMu, i.tx, func() {
+		for _, title := range imported {
+			i.titles.saved(&title.Title)
+		}
+	})
+}
+
+// Close rolls back the import if it hasn't been committed, and releases its resources.
+func (i *sqliteImporter) Close() {
+	if i.stmt != nil {
+		i.stmt.Close()
+	}
+	i.tx.Rollback()
+	i.cancel()
+}
+
+// GetCatalog returns every title, including the columns loaded from the catalog dataset.
+func (s SQLiteTitleModel) GetCatalog(ctx context.Context) ([]*CatalogTitle, error) {
+	// create a context with a 30-second timeout deadline, since every title is read
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	return s.catalog(ctx, nil, nil)
+}
+
+// Refresh reads the catalog and inserts, updates and deletes the titles returned by fn in a single
+// transaction, the same way as TitleModel.Refresh(). Transactions begin with BEGIN IMMEDIATE (see
+// OpenSQLite), which already locks the database against other writes.
+func (s SQLiteTitleModel) Refresh(ctx context.Context, fn RefreshFunc) error {
+	ctx, cancel := context.WithTimeout(ctx, importTimeout)
+	defer cancel()
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	// Rollback() is a no-op once the transaction has been committed
+	defer tx.Rollback()
+
+	existing, err := queryCatalog(ctx, tx, nil, nil)
+	if err != nil {
+		return err
+	}
+	inserted, updated, deleted, err := fn(existing)
+	if err != nil {
+		return err
+	}
+
+	if len(inserted) > 0 {
+		stmt, err := tx.PrepareContext(ctx, `
+		INSERT INTO titles (show_id, title_type, title, director, country, release_year, date_added, rating, description)
+		VALUES (?1, ?2, ?3, ?4, ?5, ?6, ?7, ?8, ?9)
+		RETURNING id`)
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+
+		for _, title := range inserted {
+			err := stmt.QueryRowContext(ctx, sqliteCatalogArgs(title)...).Scan(&title.ID)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if len(updated) > 0 {
+		stmt, err := tx.PrepareContext(ctx, `
+		UPDATE titles
+		SET show_id = ?1, title_type = ?2, title = ?3, director = ?4, country = ?5, release_year = ?6,
+			date_added = ?7, rating = ?8, description = ?9
+		WHERE id = ?10`)
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+
+		for _, title := range updated {
+			result, err := stmt.ExecContext(ctx, append(sqliteCatalogArgs(title), title.ID)...)
+			if err != nil {
+				return err
+			}
+			rowsAffected, err := result.RowsAffected()
+			if err != nil {
+				return err
+			}
+			if rowsAffected == 0 {
+				return ErrRecordNotFound
+			}
+		}
+	}
+
+	if len(deleted) > 0 {
+		list, err := sqliteIDs(deleted)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, `DELETE FROM titles WHERE id IN (SELECT value FROM json_each(?1))`, list)
+		if err != nil {
+			return err
+		}
+	}
+
+	return commitAndNotify(s.commitMu, tx, func() {
+		for _, title := range inserted {
+			s.saved(&title.Title)
+		}
+		for _, title := range updated {
+			s.saved(&title.Title)
+		}
+		for _, id := range deleted {
+			s.deleted(id)
+		}
+	})
+}
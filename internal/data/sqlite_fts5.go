@@ -0,0 +1,20 @@
+//go:build sqlite_fts5
+// +build sqlite_fts5
+
+package data
+
+// The SQLite driver needs cgo, so it's only built in with -tags sqlite_fts5 (which also builds in FTS5). The
+// PostgreSQL-only binary doesn't need either, and is built with sqlite_nodriver.go instead.
+
+import (
+	"errors"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// sqliteCanceled reports whether err is SQLite's error for a query that was interrupted, as it is when its
+// context is canceled.
+func sqliteCanceled(err error) bool {
+	var sqliteErr sqlite3.Error
+	return errors.As(err, &sqliteErr) && sqliteErr.Code == sqlite3.ErrInterrupt
+}
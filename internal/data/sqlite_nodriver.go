@@ -0,0 +1,10 @@
+//go:build !sqlite_fts5
+// +build !sqlite_fts5
+
+package data
+
+// sqliteCanceled always returns false, since there are no SQLite errors without the SQLite driver. See
+// sqlite_fts5.go.
+func sqliteCanceled(err error) bool {
+	return false
+}
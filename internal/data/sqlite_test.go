@@ -0,0 +1,91 @@
+//go:build sqlite_fts5
+// +build sqlite_fts5
+
+package data
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+// newSQLiteRepository returns a SQLiteTitleModel for a new SQLite database in a temporary directory, with
+// the migrations in migrations/sqlite run on it.
+func newSQLiteRepository(t *testing.T) TitleRepository {
+	db, err := OpenSQLite("sqlite3://" + filepath.Join(t.TempDir(), "netflix.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	files, err := filepath.Glob(filepath.Join("..", "..", "migrations", "sqlite", "*.up.sql"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(files)
+	for _, file := range files {
+		migration, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = db.Exec(string(migration))
+		if err != nil {
+			t.Fatalf("%s: %v", file, err)
+		}
+	}
+
+	titles := NewSQLiteModels(db, DefaultQueryTimeout).Titles
+	err = titles.CheckSchema(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return titles
+}
+
+// TestSQLiteTitleModel runs the shared repository tests against SQLiteTitleModel.
+func TestSQLiteTitleModel(t *testing.T) {
+	testRepository(t, newSQLiteRepository)
+}
+
+// TestSQLiteYearCheck checks that the release year's bounds are enforced like PostgreSQL's
+// titles_year_check: the lower bound by a CHECK constraint, and the upper bound by triggers.
+func TestSQLiteYearCheck(t *testing.T) {
+	repo := newSQLiteRepository(t)
+	ctx := context.Background()
+	nextYear := int32(time.Now().Year() + 1)
+
+	tests := []struct {
+		name    string
+		year    int32
+		wantErr bool
+	}{
+		{"first film", 1888, false},
+		{"this year", int32(time.Now().Year()), false},
+		{"before the first film", 1887, true},
+		{"next year", nextYear, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			title := &Title{TitleType: "Movie", Title: "Roma", Director: "Alfonso Cuarón", Country: "Mexico", ReleaseYear: tt.year}
+			err := repo.Insert(ctx, title)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Insert: got error %v; want error %t", err, tt.wantErr)
+			}
+		})
+	}
+
+	title := &Title{TitleType: "Movie", Title: "Roma", Director: "Alfonso Cuarón", Country: "Mexico", ReleaseYear: 2018}
+	err := repo.Insert(ctx, title)
+	if err != nil {
+		t.Fatal(err)
+	}
+	title.ReleaseYear = nextYear
+	err = repo.Update(ctx, title)
+	if err == nil {
+		t.Errorf("Update to next year: got nil error; want an error")
+	}
+}
@@ -0,0 +1,133 @@
+package data
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// maxCachedStats is the most results StatsModel caches before it starts over with an empty cache.
+const maxCachedStats = 1000
+
+// statsCacheTTL is how long StatsModel caches a result. Writes through the TitleRepository it observes clear
+// the cache straight away, but writes from another process (cmd/refresh, another API server, or psql) can't
+// be seen, so they only show up in the statistics once the cached results have expired.
+const statsCacheTTL = time.Minute
+
+// Stats holds aggregate counts over the titles that match a set of filters.
+type Stats struct {
+	Total        int          `json:"total"`
+	TitleTypes   []FacetCount `json:"title_types"`
+	TopCountries []FacetCount `json:"top_countries"`
+	TopDirectors []FacetCount `json:"top_directors"`
+	ReleaseYears []FacetCount `json:"release_years"`
+}
+
+// statsKey identifies a cached Stats result.
+type statsKey struct {
+	filters TitleFilters
+	limit   int
+}
+
+// cachedStats is a cached Stats result, and when it stops being used.
+type cachedStats struct {
+	stats   *Stats
+	expires time.Time
+}
+
+// statsCache holds the Stats results computed since the titles table last changed. generation counts the
+// changes, so a result computed from before a change isn't cached after it.
+type statsCache struct {
+	mu         sync.Mutex
+	generation int
+	results    map[statsKey]cachedStats
+}
+
+// StatsModel computes catalog statistics from the titles table. Results are cached until a title is written
+// through the TitleModel it observes, the cache is flushed, or statsCacheTTL passes.
+type StatsModel struct {
+	titles TitleRepository
+	cache  *statsCache
+}
+
+// newStatsModel creates a StatsModel for titles, and registers it to observe titles' writes.
+func newStatsModel(titles TitleRepository) StatsModel {
+	s := StatsModel{
+		titles: titles,
+		cache:  &statsCache{results: make(map[statsKey]cachedStats)},
+	}
+	titles.Observe(s)
+	return s
+}
+
+// Get returns the statistics for the titles that match filters, including up to limit of the top countries
+// and directors. Every title type and release year is counted.
+func (s StatsModel) Get(ctx context.Context, filters TitleFilters, limit int) (*Stats, error) {
+	key := statsKey{filters: filters, limit: limit}
+
+	s.cache.mu.Lock()
+	cached, ok := s.cache.results[key]
+	generation := s.cache.generation
+	s.cache.mu.Unlock()
+	if ok && time.Now().Before(cached.expires) {
+		return cached.stats, nil
+	}
+
+	facets, err := s.titles.CountFacets(ctx, filters, map[string]int{
+		"title_type":   0,
+		"country":      limit,
+		"director":     limit,
+		"release_year": 0,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &Stats{
+		TitleTypes:   facets["title_type"],
+		TopCountries: facets["country"],
+		TopDirectors: facets["director"],
+		ReleaseYears: facets["release_year"],
+	}
+	// every title has exactly one title type, so they add up to the total
+	for _, count := range stats.TitleTypes {
+		stats.Total += count.Count
+	}
+	// list release years in chronological order, rather than by count
+	sort.Slice(stats.ReleaseYears, func(i, j int) bool {
+		return stats.ReleaseYears[i].Value < stats.ReleaseYears[j].Value
+	})
+
+	s.cache.mu.Lock()
+	defer s.cache.mu.Unlock()
+
+	// don't cache the result if a title was written while it was being computed
+	if s.cache.generation == generation {
+		if len(s.cache.results) >= maxCachedStats {
+			s.cache.results = make(map[statsKey]cachedStats)
+		}
+		s.cache.results[key] = cachedStats{stats: stats, expires: time.Now().Add(statsCacheTTL)}
+	}
+
+	return stats, nil
+}
+
+// TitleSaved clears the cache, since the new or updated title may change any statistic.
+func (s StatsModel) TitleSaved(title *Title) {
+	s.Flush()
+}
+
+// TitleDeleted clears the cache, since the deleted title may change any statistic.
+func (s StatsModel) TitleDeleted(id int64) {
+	s.Flush()
+}
+
+// Flush clears the cache, e.g. after the titles table was changed by another process.
+func (s StatsModel) Flush() {
+	s.cache.mu.Lock()
+	defer s.cache.mu.Unlock()
+
+	s.cache.generation++
+	s.cache.results = make(map[statsKey]cachedStats)
+}
@@ -0,0 +1,219 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"danielmatsuda15.rest/internal/validator"
+)
+
+// the periods a timeline can be bucketed by
+const (
+	ByReleaseYear = "release_year"
+	ByAddedMonth  = "added_month"
+)
+
+// layouts of the two kinds of period. They're also the format of the from/to bounds.
+const (
+	yearLayout  = "2006"
+	monthLayout = "2006-01"
+)
+
+// TimelineQuery holds the client's params for a timeline, besides the title filters. From and To are
+// optional, inclusive bounds in the same format as the periods: a year, or a month like "2021-09".
+type TimelineQuery struct {
+	By    string
+	Group string
+	From  string
+	To    string
+}
+
+// TimelineBucket is the number of matching titles in one period. If the timeline is grouped, Groups breaks
+// Count down by each group's value.
+type TimelineBucket struct {
+	Period string         `json:"period"`
+	Count  int            `json:"count"`
+	Groups map[string]int `json:"groups,omitempty"`
+}
+
+// ValidateTimelineQuery checks the timeline's bucketing, grouping and bounds.
+func ValidateTimelineQuery(v *validator.Validator, q TimelineQuery) {
+	v.Check(validator.In(q.By, ByReleaseYear, ByAddedMonth), "by", "must be release_year or added_month")
+	v.Check(validator.In(q.Group, "", "title_type"), "group", "must be title_type")
+
+	for key, period := range map[string]string{"from": q.From, "to": q.To} {
+		if period == "" {
+			continue
+		}
+		t, err := q.parsePeriod(period)
+		v.Check(err == nil, key, "must be a "+q.periodFormat())
+		v.Check(err != nil || t.Year() >= 1888, key, "must not be before 1888")
+		v.Check(err != nil || t.Year() <= time.Now().Year(), key, "must not be in the future")
+	}
+	if q.From != "" && q.To != "" {
+		v.Check(q.From <= q.To, "to", "must not be before from")
+	}
+}
+
+// periodFormat describes the format of the query's periods, for validation messages.
+func (q TimelineQuery) periodFormat() string {
+	if q.By == ByAddedMonth {
+		return "month in YYYY-MM format"
+	}
+	return "year in YYYY format"
+}
+
+// parsePeriod parses a period as a time at the start of that period.
+func (q TimelineQuery) parsePeriod(period string) (time.Time, error) {
+	if q.By == ByAddedMonth {
+		return time.Parse(monthLayout, period)
+	}
+	return time.Parse(yearLayout, period)
+}
+
+// formatPeriod formats the period starting at t.
+func (q TimelineQuery) formatPeriod(t time.Time) string {
+	if q.By == ByAddedMonth {
+		return t.Format(monthLayout)
+	}
+	return t.Format(yearLayout)
+}
+
+// nextPeriod returns the start of the period after the one starting at t.
+func (q TimelineQuery) nextPeriod(t time.Time) time.Time {
+	if q.By == ByAddedMonth {
+		return t.AddDate(0, 1, 0)
+	}
+	return t.AddDate(1, 0, 0)
+}
+
+// Timeline counts the titles that match filters in each period, from q.From to q.To. Periods without
+// any titles are included with a zero count. If either bound isn't given, the timeline starts or ends with
+// the first or last period that has a matching title. Titles without a date_added aren't counted by month.
+func (s StatsModel) Timeline(ctx context.Context, filters TitleFilters, q TimelineQuery) ([]*TimelineBucket, error) {
+	return s.titles.Timeline(ctx, filters, q)
+}
+
+// Timeline counts the matching titles in each period for StatsModel.Timeline().
+func (t TitleModel) Timeline(ctx context.Context, filters TitleFilters, q TimelineQuery) ([]*TimelineBucket, error) {
+	conditions, args := filters.conditions(nil)
+
+	// the period each title falls in, formatted the same way as formatPeriod()
+	period := "release_year::text"
+	if q.By == ByAddedMonth {
+		period = "to_char(date_added, 'YYYY-MM')"
+		conditions = append(conditions, "date_added IS NOT NULL")
+	}
+	// periods of the same format compare the same as strings and as dates
+	if q.From != "" {
+		args = append(args, q.From)
+		conditions = append(conditions, fmt.Sprintf("%s >= $%d", period, len(args)))
+	}
+	if q.To != "" {
+		args = append(args, q.To)
+		conditions = append(conditions, fmt.Sprintf("%s <= $%d", period, len(args)))
+	}
+
+	group := "''"
+	if q.Group != "" {
+		group = q.Group
+	}
+
+	query := fmt.Sprintf(`
+	SELECT %s AS period, %s AS grp, COUNT(*)
+	FROM titles
+	%s
+	GROUP BY 1, 2`, period, group, where(conditions))
+
+	// derive a context from ctx, with the query timeout as its deadline
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	// release context's resources before Timeline() returns. Otherwise, those resources will be held
+	// until timeout or the parent context is canceled. Prevents memory leaks!
+	defer cancel()
+
+	rows, err := t.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	// counts holds each period's count per group. Every group that appears is listed in each bucket
+	counts := make(map[string]map[string]int)
+	groups := make(map[string]bool)
+	for rows.Next() {
+		var period, group string
+		var count int
+		err := rows.Scan(&period, &group, &count)
+		if err != nil {
+			return nil, err
+		}
+		if counts[period] == nil {
+			counts[period] = make(map[string]int)
+		}
+		counts[period][group] = count
+		groups[group] = true
+	}
+
+	// confirm there were no errors during the calls to row.Next()
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return q.fillBuckets(counts, groups)
+}
+
+// fillBuckets creates a bucket for every period between the query's bounds, using counts for the periods
+// that have titles and zero for the gaps.
+func (q TimelineQuery) fillBuckets(counts map[string]map[string]int, groups map[string]bool) ([]*TimelineBucket, error) {
+	buckets := []*TimelineBucket{}
+
+	// default to the first and last periods with titles
+	periods := []string{}
+	for period := range counts {
+		periods = append(periods, period)
+	}
+	sort.Strings(periods)
+	from, to := q.From, q.To
+	if len(periods) > 0 {
+		if from == "" {
+			from = periods[0]
+		}
+		if to == "" {
+			to = periods[len(periods)-1]
+		}
+	}
+	if from == "" || to == "" {
+		return buckets, nil
+	}
+
+	start, err := q.parsePeriod(from)
+	if err != nil {
+		return nil, err
+	}
+	end, err := q.parsePeriod(to)
+	if err != nil {
+		return nil, err
+	}
+
+	for t := start; !t.After(end); t = q.nextPeriod(t) {
+		bucket := &TimelineBucket{Period: q.formatPeriod(t)}
+		if q.Group != "" {
+			bucket.Groups = make(map[string]int)
+			for group := range groups {
+				bucket.Groups[group] = 0
+			}
+		}
+		for group, count := range counts[bucket.Period] {
+			bucket.Count += count
+			if q.Group != "" {
+				bucket.Groups[group] = count
+			}
+		}
+		buckets = append(buckets, bucket)
+	}
+
+	return buckets, nil
+}
@@ -4,9 +4,12 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
+	"sync"
 	"time"
 
 	"danielmatsuda15.rest/internal/validator"
+	"github.com/lib/pq"
 )
 
 // Title holds values parsed from the client's POST request body.
@@ -33,13 +36,63 @@ func ValidateTitle(v *validator.Validator, title *Title) {
 	v.Check(title.ReleaseYear <= int32(time.Now().Year()), "release_year", "must not be in the future")
 }
 
+// TitleObserver is notified of every title written through a TitleModel, e.g. to keep a copy of the
+// titles table in sync.
+type TitleObserver interface {
+	TitleSaved(title *Title)
+	TitleDeleted(id int64)
+}
+
+// TitleModel queries the titles table. Each method's query is canceled when the ctx passed to it is, e.g.
+// because the client that made the request went away, and when timeout passes.
 type TitleModel struct {
-	DB *sql.DB
+	DB        *sql.DB
+	observers *[]TitleObserver
+	commitMu  *sync.Mutex
+	timeout   time.Duration
+}
+
+// Observe registers o to be notified after each successful Insert, Update and Delete. Observers should be
+// registered at startup, before the model is shared between goroutines.
+func (t TitleModel) Observe(o TitleObserver) {
+	*t.observers = append(*t.observers, o)
+}
+
+// saved notifies the observers that title was inserted or updated.
+func (t TitleModel) saved(title *Title) {
+	for _, o := range *t.observers {
+		o.TitleSaved(title)
+	}
+}
+
+// deleted notifies the observers that the title with the given id was deleted.
+func (t TitleModel) deleted(id int64) {
+	for _, o := range *t.observers {
+		o.TitleDeleted(id)
+	}
+}
+
+// commitAndNotify commits tx, then calls notify to notify the observers of its writes, with mu held
+// throughout. A transaction that writes the same title as tx waits for tx's row locks, so it commits after
+// tx, and then has to wait for mu until the observers have seen tx's writes. That way the observers see the
+// writes in the order they were committed. mu isn't held while a transaction's statements run, since they may
+// be waiting for another transaction's locks, and that transaction needs mu to commit.
+func commitAndNotify(mu *sync.Mutex, tx *sql.Tx, notify func()) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	err := tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	notify()
+	return nil
 }
 
 // Insert inserts a new row into the titles table.
 // It takes a pointer to a Title struct. That Title contains the data to populate the new record.
-func (t TitleModel) Insert(title *Title) error {
+func (t TitleModel) Insert(ctx context.Context, title *Title) error {
 	// create new entry and return some data for the API's response
 	query := `
 	INSERT INTO titles (title_type, title, director, country, release_year)
@@ -49,48 +102,100 @@ func (t TitleModel) Insert(title *Title) error {
 	// args to pass into SQL placeholders. If necessary, convert types here using pq
 	args := []interface{}{title.TitleType, title.Title, title.Director, title.Country, title.ReleaseYear}
 
-	// create an empty context.Context instance, with a 3 second timeout
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	// derive a context from ctx, with the query timeout as its deadline
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
 	// release context's resources before Get() returns. Otherwise, those resources will be held
 	// until timeout or the parent context is canceled. Prevents memory leaks!
 	defer cancel()
 
-	// QueryRow() executes query on the t.DB connection pool, with args as a variadic param.
+	// the insert runs in a transaction, so the observers can be notified as it's committed
+	tx, err := t.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	// Rollback() is a no-op once the transaction has been committed
+	defer tx.Rollback()
+
+	// QueryRow() executes query in the transaction, with args as a variadic param.
 	// Scan writes the query's returned values into fields of the title struct (here, just title.ID)
-	return t.DB.QueryRowContext(ctx, query, args...).Scan(&title.ID)
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&title.ID)
+	if err != nil {
+		return err
+	}
+
+	return commitAndNotify(t.commitMu, tx, func() {
+		t.saved(title)
+	})
+}
+
+// InsertMany inserts titles into the titles table in a single transaction, and writes each new row's id to
+// its Title. If any insert fails, the transaction is rolled back and none of the titles are inserted.
+func (t TitleModel) InsertMany(ctx context.Context, titles []*Title) error {
+	query := `
+	INSERT INTO titles (title_type, title, director, country, release_year)
+	VALUES ($1, $2, $3, $4, $5)
+	RETURNING id`
+
+	// derive a context from ctx, with the query timeout as its deadline
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	// release context's resources before InsertMany() returns. Otherwise, those resources will be held
+	// until timeout or the parent context is canceled. Prevents memory leaks!
+	defer cancel()
+
+	tx, err := t.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	// Rollback() is a no-op once the transaction has been committed
+	defer tx.Rollback()
+
+	// prepare the statement once, rather than once per title
+	stmt, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, title := range titles {
+		args := []interface{}{title.TitleType, title.Title, title.Director, title.Country, title.ReleaseYear}
+		err := stmt.QueryRowContext(ctx, args...).Scan(&title.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return commitAndNotify(t.commitMu, tx, func() {
+		for _, title := range titles {
+			t.saved(title)
+		}
+	})
 }
 
 // Get uses the id parameter given to return a single row from the db in a Title struct instance.
+// Only the columns in fields are selected, or every column if fields is empty.
 // May return an ErrRecordNotFound error if the query is invalid.
-func (t TitleModel) Get(id int64) (*Title, error) {
+func (t TitleModel) Get(ctx context.Context, id int64, fields Fieldset) (*Title, error) {
 	// additional naive check for valid id
 	if id < 1 {
 		return nil, ErrRecordNotFound
 	}
-	query := `
-	SELECT *
+	query := fmt.Sprintf(`
+	SELECT %s
 	FROM titles
-	WHERE id = $1`
+	WHERE id = $1`, fields.columns())
 
 	// hold the returned data in a new Title struct
 	var title Title
 
-	// create an empty context.Context instance, with a 3 second timeout
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	// derive a context from ctx, with the query timeout as its deadline
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
 	// release context's resources before Get() returns. Otherwise, those resources will be held
 	// until timeout or the parent context is canceled. Prevents memory leaks!
 	defer cancel()
 
 	// Execute query and scan response into Title struct.
-	// Scan writes the query's returned values into specified fields of the title struct
-	err := t.DB.QueryRowContext(ctx, query, id).Scan(
-		&title.ID,
-		&title.TitleType,
-		&title.Title,
-		&title.Director,
-		&title.Country,
-		&title.ReleaseYear,
-	)
+	// Scan writes the query's returned values into the selected fields of the title struct
+	err := t.DB.QueryRowContext(ctx, query, id).Scan(fields.dest(&title)...)
 	// If no matching entry was found, a sql.ErrNoRows error will be returned.
 	// In this case, return the custom ErrRecordNotFound error instead.
 	if err != nil {
@@ -105,50 +210,39 @@ func (t TitleModel) Get(id int64) (*Title, error) {
 	return &title, nil
 }
 
-// GetAll returns all rows and all columns from the titles table in a slice -- if the filterParams are all
-// empty strings. Otherwise, only returns the slice of all rows and columns that meet filter criteria.
-func (t TitleModel) GetAll(filterParams []interface{}) ([]*Title, error) {
-	// each filter param's WHERE clause is skipped if the value passed in is an empty string
-	// PostgreSQL allows for full text searches:
-	// https://www.postgresql.org/docs/13/textsearch-intro.html#TEXTSEARCH-MATCHING
-	query := `
-	SELECT *
+// GetMany returns the titles with the given ids in a single query, in the same order as ids. Ids that don't
+// exist are skipped, so fewer titles than ids may be returned. Only the columns in fields are selected,
+// along with id.
+func (t TitleModel) GetMany(ctx context.Context, ids []int64, fields Fieldset) ([]*Title, error) {
+	// the id column is always selected, to put the titles back in the requested order
+	fields = fields.withID()
+
+	query := fmt.Sprintf(`
+	SELECT %s
 	FROM titles
-	WHERE (to_tsvector('simple', title) @@ plainto_tsquery('simple', $1) OR $1 = '')
-	AND (to_tsvector('simple', country) @@ plainto_tsquery('simple', $2) OR $2 = '')
-	AND (LOWER(title_type) = LOWER($3) OR $3 = '')
-	AND (LOWER(director) = LOWER($4) OR $4 = '')
-	ORDER BY id`
-
-	// create an empty context.Context instance, with a 3 second timeout
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	// release context's resources before Get() returns. Otherwise, those resources will be held
+	WHERE id = ANY($1)`, fields.columns())
+
+	// derive a context from ctx, with the query timeout as its deadline
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	// release context's resources before GetMany() returns. Otherwise, those resources will be held
 	// until timeout or the parent context is canceled. Prevents memory leaks!
 	defer cancel()
 
-	// execute the query. Returns a sql.Results object into the rows var
-	rows, err := t.DB.QueryContext(ctx, query, filterParams...)
+	// pq.Array() converts the []int64 to a PostgreSQL bigint[]
+	rows, err := t.DB.QueryContext(ctx, query, pq.Array(ids))
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	// copy each result row into its own Title struct. Hold all Titles in a slice.
-	titles := []*Title{}
+	found := make(map[int64]*Title)
 	for rows.Next() {
 		var title Title
-		err := rows.Scan(
-			&title.ID,
-			&title.TitleType,
-			&title.Title,
-			&title.Director,
-			&title.Country,
-			&title.ReleaseYear,
-		)
+		err := rows.Scan(fields.dest(&title)...)
 		if err != nil {
 			return nil, err
 		}
-		titles = append(titles, &title)
+		found[title.ID] = &title
 	}
 
 	// confirm there were no errors during the calls to row.Next()
@@ -157,19 +251,149 @@ func (t TitleModel) GetAll(filterParams []interface{}) ([]*Title, error) {
 		return nil, err
 	}
 
+	// put the titles back in the requested order
+	titles := []*Title{}
+	for _, id := range ids {
+		if title, ok := found[id]; ok {
+			titles = append(titles, title)
+		}
+	}
+	return titles, nil
+}
+
+// GetAll returns all rows from the titles table in a slice -- if the filters are all empty strings. Otherwise,
+// only returns the slice of all rows that meet filter criteria. Only the columns in fields are selected, or
+// every column held by Title if fields is empty.
+func (t TitleModel) GetAll(ctx context.Context, filters TitleFilters, fields Fieldset) ([]*Title, error) {
+	// derive a context from ctx, with the query timeout as its deadline
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	// release context's resources before Get() returns. Otherwise, those resources will be held
+	// until timeout or the parent context is canceled. Prevents memory leaks!
+	defer cancel()
+
+	// hold all Titles in a slice
+	titles := []*Title{}
+	err := t.each(ctx, filters, fields, func(title *Title) error {
+		titles = append(titles, title)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
 	// finally, return the slice of titles if no errors were found
 	return titles, nil
 }
 
+// streamTimeout is how long GetAllFunc() may take. fn is called while the rows are being read, so a slow
+// consumer, like a client downloading the whole catalog, holds the query open for longer than usual.
+const streamTimeout = 30 * time.Second
+
+// GetAllFunc calls fn with each title that GetAll() would return, in the same order, as each row is scanned.
+// The titles aren't collected in memory. If fn returns an error, no more rows are read and the error is
+// returned.
+func (t TitleModel) GetAllFunc(ctx context.Context, filters TitleFilters, fields Fieldset, fn func(*Title) error) error {
+	ctx, cancel := context.WithTimeout(ctx, streamTimeout)
+	defer cancel()
+
+	return t.each(ctx, filters, fields, fn)
+}
+
+// each runs the query for GetAll() and GetAllFunc(), and calls fn with each scanned title.
+func (t TitleModel) each(ctx context.Context, filters TitleFilters, fields Fieldset, fn func(*Title) error) error {
+	// each filter's WHERE condition is skipped if the value passed in is an empty string.
+	// The title and director conditions depend on the requested match mode (see filters.go)
+	where, args := filters.whereClause(nil)
+	query := fmt.Sprintf(`
+	SELECT %s
+	FROM titles
+	%s
+	ORDER BY id`, fields.columns(), where)
+
+	// execute the query. Returns a sql.Results object into the rows var
+	rows, err := t.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	// copy each result row into its own Title struct
+	for rows.Next() {
+		var title Title
+		err := rows.Scan(fields.dest(&title)...)
+		if err != nil {
+			return err
+		}
+		err = fn(&title)
+		if err != nil {
+			return err
+		}
+	}
+
+	// confirm there were no errors during the calls to row.Next()
+	return rows.Err()
+}
+
+// Suggest returns up to limit distinct titles that are spelled similarly to filters.Title, closest first.
+// The other filters still apply, so each suggestion is a search that will return results. Similarity is
+// measured with pg_trgm trigrams, using the LOWER(title) trigram index from migration 000005.
+func (t TitleModel) Suggest(ctx context.Context, filters TitleFilters, limit int) ([]string, error) {
+	term := filters.Title
+	filters.Title = ""
+
+	// a title is suggested if it's similar to the whole term (%), or if the term is similar to
+	// some run of words inside the title (<%), e.g. "strnger" for "Stranger Things"
+	conditions, args := filters.conditions([]interface{}{term, limit})
+	conditions = append(conditions, "(LOWER(title) % LOWER($1) OR LOWER($1) <% LOWER(title))")
+	query := fmt.Sprintf(`
+	SELECT title
+	FROM titles
+	%s
+	GROUP BY title
+	ORDER BY GREATEST(similarity(LOWER(title), LOWER($1)), word_similarity(LOWER($1), LOWER(title))) DESC, title
+	LIMIT $2`, where(conditions))
+
+	// derive a context from ctx, with the query timeout as its deadline
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	// release context's resources before Suggest() returns. Otherwise, those resources will be held
+	// until timeout or the parent context is canceled. Prevents memory leaks!
+	defer cancel()
+
+	rows, err := t.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	suggestions := []string{}
+	for rows.Next() {
+		var suggestion string
+		err := rows.Scan(&suggestion)
+		if err != nil {
+			return nil, err
+		}
+		suggestions = append(suggestions, suggestion)
+	}
+
+	// confirm there were no errors during the calls to row.Next()
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return suggestions, nil
+}
+
 // Update runs a SQL UPDATE command using data params from title. If successful,
-// it returns the entry's updated data in the title struct.
-func (t TitleModel) Update(title *Title) error {
+// it returns the entry's updated data in the title struct. Returns an ErrRecordNotFound error if there's
+// no title with title.ID.
+func (t TitleModel) Update(ctx context.Context, title *Title) error {
 	// to update an entry, you must provide ALL values, including values that haven't changed
-	query := `
+	query := fmt.Sprintf(`
 UPDATE titles
 SET title_type = $1, title = $2, director = $3, country = $4, release_year = $5
 WHERE id = $6
-RETURNING id, title_type, title, director, country, release_year`
+RETURNING %s`, titleColumns)
 
 	// params from title to pass into query
 	args := []interface{}{
@@ -181,25 +405,39 @@ RETURNING id, title_type, title, director, country, release_year`
 		title.ID,
 	}
 
-	// create an empty context.Context instance, with a 3 second timeout
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	// derive a context from ctx, with the query timeout as its deadline
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
 	// release context's resources before Get() returns. Otherwise, those resources will be held
 	// until timeout or the parent context is canceled. Prevents memory leaks!
 	defer cancel()
 
-	// query and read the result into title. Then return title
-	return t.DB.QueryRowContext(ctx, query, args...).Scan(
-		&title.ID,
-		&title.TitleType,
-		&title.Title,
-		&title.Director,
-		&title.Country,
-		&title.ReleaseYear)
+	tx, err := t.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	// Rollback() is a no-op once the transaction has been committed
+	defer tx.Rollback()
+
+	// query and read the result into title. Then return title. If the title was deleted since it was
+	// read, no row is returned
+	err = scanTitle(tx.QueryRowContext(ctx, query, args...), title)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	return commitAndNotify(t.commitMu, tx, func() {
+		t.saved(title)
+	})
 }
 
 // Delete deletes the entry with the given id, and returns nil if successful. If the entry with that id
 // doesn't exist in the database, returns an error.
-func (t TitleModel) Delete(id int64) error {
+func (t TitleModel) Delete(ctx context.Context, id int64) error {
 	// additional naive check for valid id
 	if id < 1 {
 		return ErrRecordNotFound
@@ -209,14 +447,21 @@ func (t TitleModel) Delete(id int64) error {
 	DELETE FROM titles
 	WHERE id = $1`
 
-	// create an empty context.Context instance, with a 3 second timeout
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	// derive a context from ctx, with the query timeout as its deadline
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
 	// release context's resources before Get() returns. Otherwise, those resources will be held
 	// until timeout or the parent context is canceled. Prevents memory leaks!
 	defer cancel()
 
+	tx, err := t.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	// Rollback() is a no-op once the transaction has been committed
+	defer tx.Rollback()
+
 	// execute the query for the given id. Returns a sql.Result object
-	result, err := t.DB.ExecContext(ctx, query, id)
+	result, err := tx.ExecContext(ctx, query, id)
 	if err != nil {
 		return err
 	}
@@ -231,5 +476,7 @@ func (t TitleModel) Delete(id int64) error {
 		return ErrRecordNotFound
 	}
 
-	return nil
+	return commitAndNotify(t.commitMu, tx, func() {
+		t.deleted(id)
+	})
 }
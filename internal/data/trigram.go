@@ -0,0 +1,54 @@
+package data
+
+import "strings"
+
+// the default pg_trgm thresholds of the % and <% operators, which Suggest() filters titles with
+const (
+	similarityThreshold     = 0.3
+	wordSimilarityThreshold = 0.6
+)
+
+// trigrams returns the set of trigrams in s, extracted the way pg_trgm does: each word is lowercased and
+// padded with two spaces in front and one behind, e.g. "cat" has the trigrams "  c", " ca", "cat" and "at ".
+func trigrams(s string) map[string]bool {
+	set := make(map[string]bool)
+	for _, word := range Tokenize(s) {
+		runes := []rune("  " + word + " ")
+		for i := 0; i+3 <= len(runes); i++ {
+			set[string(runes[i:i+3])] = true
+		}
+	}
+	return set
+}
+
+// trigramSimilarity returns the number of trigrams a and b share, divided by the number of trigrams in
+// either of them, like pg_trgm's similarity(). Strings without any trigrams aren't similar.
+func trigramSimilarity(a, b map[string]bool) float64 {
+	shared := 0
+	for trigram := range a {
+		if b[trigram] {
+			shared++
+		}
+	}
+	all := len(a) + len(b) - shared
+	if all == 0 {
+		return 0
+	}
+	return float64(shared) / float64(all)
+}
+
+// wordSimilarity approximates pg_trgm's word_similarity(term, s) with the highest trigramSimilarity() between
+// term's trigrams and any run of consecutive words in s.
+func wordSimilarity(term map[string]bool, s string) float64 {
+	words := Tokenize(s)
+	best := 0.0
+	for i := range words {
+		for j := i + 1; j <= len(words); j++ {
+			similarity := trigramSimilarity(term, trigrams(strings.Join(words[i:j], " ")))
+			if similarity > best {
+				best = similarity
+			}
+		}
+	}
+	return best
+}
@@ -0,0 +1,180 @@
+package kaggle
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"danielmatsuda15.rest/internal/data"
+	"danielmatsuda15.rest/internal/validator"
+)
+
+// FieldChange holds a field's value in the titles table, and its value in the new snapshot of the dataset.
+type FieldChange struct {
+	Old interface{} `json:"old"`
+	New interface{} `json:"new"`
+}
+
+// Change describes an existing title whose fields differ in the new snapshot. New holds the title's values
+// from the snapshot, with the existing title's ID.
+type Change struct {
+	ID     int64                  `json:"id"`
+	ShowID string                 `json:"show_id"`
+	Title  string                 `json:"title"`
+	Fields map[string]FieldChange `json:"fields"`
+	New    *data.CatalogTitle     `json:"-"`
+}
+
+// Diff is the difference between the titles table and a new snapshot of the dataset. Only titles that were
+// imported from the dataset (those with a show_id) can be Removed; titles created through the API are left
+// alone unless the snapshot matches them.
+type Diff struct {
+	Added     []*data.CatalogTitle `json:"added"`
+	Changed   []Change             `json:"changed"`
+	Removed   []*data.CatalogTitle `json:"removed"`
+	Rejected  []RowResult          `json:"rejected"`
+	Unchanged int                  `json:"unchanged"`
+}
+
+// Updated returns the new values of the changed titles, to return from a data.RefreshFunc.
+func (d *Diff) Updated() []*data.CatalogTitle {
+	titles := make([]*data.CatalogTitle, 0, len(d.Changed))
+	for _, change := range d.Changed {
+		titles = append(titles, change.New)
+	}
+	return titles
+}
+
+// RemovedIDs returns the ids of the removed titles, to return from a data.RefreshFunc.
+func (d *Diff) RemovedIDs() []int64 {
+	ids := make([]int64, 0, len(d.Removed))
+	for _, title := range d.Removed {
+		ids = append(ids, title.ID)
+	}
+	return ids
+}
+
+// Compare reads the dataset CSV from src, and compares it with the existing titles. Rows are matched to
+// existing titles by show_id, or else by title, type and release year against the titles without a show_id.
+// Rows that can't be converted, fail validation, or repeat an earlier row's show_id are rejected.
+func Compare(src io.Reader, existing []*data.CatalogTitle) (*Diff, error) {
+	reader, err := NewReader(src)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCSV, err)
+	}
+
+	byShowID := make(map[string]*data.CatalogTitle)
+	byKey := make(map[string]*data.CatalogTitle)
+	for _, title := range existing {
+		if title.ShowID != "" {
+			byShowID[title.ShowID] = title
+		} else if _, ok := byKey[matchKey(title)]; !ok {
+			byKey[matchKey(title)] = title
+		}
+	}
+
+	diff := &Diff{
+		Added:    []*data.CatalogTitle{},
+		Changed:  []Change{},
+		Removed:  []*data.CatalogTitle{},
+		Rejected: []RowResult{},
+	}
+	seen := make(map[string]bool)
+	for {
+		title, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		var rowErr *RowError
+		switch {
+		case errors.As(err, &rowErr):
+			diff.Rejected = append(diff.Rejected, RowResult{Row: rowErr.Row, ShowID: rowErr.ShowID, Errors: rowErr.Errors})
+			continue
+		case err != nil:
+			return nil, fmt.Errorf("%w: %v", ErrInvalidCSV, err)
+		}
+
+		v := validator.New()
+		data.ValidateTitle(v, &title.Title)
+		v.Check(!seen[title.ShowID], "show_id", "must not repeat an earlier row's show_id")
+		if !v.Valid() {
+			diff.Rejected = append(diff.Rejected, RowResult{Row: reader.Row(), ShowID: title.ShowID, Errors: v.Errors})
+			continue
+		}
+		seen[title.ShowID] = true
+
+		// each existing title is matched at most once, so whatever is left over at the end is missing
+		old, ok := byShowID[title.ShowID]
+		if ok {
+			delete(byShowID, title.ShowID)
+		} else if old, ok = byKey[matchKey(title)]; ok {
+			delete(byKey, matchKey(title))
+		} else {
+			diff.Added = append(diff.Added, title)
+			continue
+		}
+
+		title.ID = old.ID
+		fields := compareFields(old, title)
+		if len(fields) == 0 {
+			diff.Unchanged++
+			continue
+		}
+		diff.Changed = append(diff.Changed, Change{
+			ID:     old.ID,
+			ShowID: title.ShowID,
+			Title:  title.Title.Title,
+			Fields: fields,
+			New:    title,
+		})
+	}
+
+	for _, title := range byShowID {
+		diff.Removed = append(diff.Removed, title)
+	}
+	sort.Slice(diff.Removed, func(i, j int) bool {
+		return diff.Removed[i].ID < diff.Removed[j].ID
+	})
+
+	return diff, nil
+}
+
+// matchKey identifies a title by its title, type and release year, ignoring case.
+func matchKey(title *data.CatalogTitle) string {
+	return fmt.Sprintf("%s\x00%s\x00%d",
+		strings.ToLower(title.Title.Title), strings.ToLower(title.TitleType), title.ReleaseYear)
+}
+
+// compareFields returns the fields whose values differ between old and new, keyed by column name.
+func compareFields(old, new *data.CatalogTitle) map[string]FieldChange {
+	fields := make(map[string]FieldChange)
+	compare := func(column string, oldValue, newValue interface{}) {
+		if oldValue != newValue {
+			fields[column] = FieldChange{Old: oldValue, New: newValue}
+		}
+	}
+
+	compare("show_id", old.ShowID, new.ShowID)
+	compare("title_type", old.TitleType, new.TitleType)
+	compare("title", old.Title.Title, new.Title.Title)
+	compare("director", old.Director, new.Director)
+	compare("country", old.Country, new.Country)
+	compare("release_year", old.ReleaseYear, new.ReleaseYear)
+	compare("date_added", formatDate(old), formatDate(new))
+	compare("rating", old.Rating, new.Rating)
+	compare("description", old.Description, new.Description)
+
+	return fields
+}
+
+// formatDate returns title's date_added as YYYY-MM-DD, or nil if it hasn't got one. Dates are compared in
+// this form, since the database returns them with a time zone.
+func formatDate(title *data.CatalogTitle) interface{} {
+	if title.DateAdded == nil {
+		return nil
+	}
+	return title.DateAdded.Format("2006-01-02")
+}
@@ -0,0 +1,127 @@
+package kaggle
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"danielmatsuda15.rest/internal/data"
+)
+
+func TestCompare(t *testing.T) {
+	existing := []*data.CatalogTitle{
+		{Title: data.Title{ID: 1, TitleType: "Movie", Title: "Dick Johnson Is Dead", Director: "Kirsten Johnson", Country: "United States", ReleaseYear: 2020}, ShowID: "s1", DateAdded: date(2021, 9, 25), Rating: "PG-13", Description: "A documentary."},
+		{Title: data.Title{ID: 2, TitleType: "TV Show", Title: "Blood & Water", Director: "Unknown", Country: "South Africa", ReleaseYear: 2021}, ShowID: "s2", DateAdded: date(2021, 9, 24), Rating: "TV-14", Description: "A drama."},
+		{Title: data.Title{ID: 3, TitleType: "TV Show", Title: "Ganglands", Director: "Julien Leclercq", Country: "Unknown", ReleaseYear: 2021}, ShowID: "s3", DateAdded: date(2021, 9, 24), Rating: "TV-MA", Description: "A heist."},
+		// created through the API, so they have no show_id
+		{Title: data.Title{ID: 4, TitleType: "Movie", Title: "Roma", Director: "Alfonso Cuarón", Country: "Mexico", ReleaseYear: 2018}},
+		{Title: data.Title{ID: 5, TitleType: "Movie", Title: "Okja", Director: "Bong Joon Ho", Country: "South Korea", ReleaseYear: 2017}},
+	}
+
+	csv := header + strings.Join([]string{
+		// unchanged
+		`s1,Movie,Dick Johnson Is Dead,Kirsten Johnson,,United States,"September 25, 2021",2020,PG-13,90 min,Documentaries,A documentary.`,
+		// rating changed
+		`s2,TV Show,Blood & Water,,,South Africa,"September 24, 2021",2021,TV-MA,2 Seasons,TV Dramas,A drama.`,
+		// matches the API's title by title, type and release year, ignoring case
+		`s4,Movie,ROMA,Alfonso Cuarón,,Mexico,"December 14, 2018",2018,R,135 min,Dramas,A year in the life.`,
+		// same title and type as Okja, but a different release year, so it's new
+		`s5,Movie,Okja,Bong Joon Ho,,South Korea,"June 28, 2017",2016,TV-MA,121 min,Dramas,A super-pig.`,
+		// repeats s5's show_id
+		`s5,Movie,Okja 2,Bong Joon Ho,,South Korea,"June 28, 2017",2017,TV-MA,121 min,Dramas,Another super-pig.`,
+		// fails validation
+		`s6,Movie,The Horse in Motion,Eadweard Muybridge,,United States,"June 28, 2017",1878,G,1 min,Documentaries,A horse.`,
+		// can't be converted
+		`s7,Movie,Sankofa,Haile Gerima,,United States,2021-09-24,1993,TV-MA,125 min,Dramas,On a photo shoot.`,
+	}, "\n") + "\n"
+
+	diff, err := Compare(strings.NewReader(csv), existing)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff.Unchanged != 1 {
+		t.Errorf("got %d unchanged; want 1", diff.Unchanged)
+	}
+
+	added := []string{}
+	for _, title := range diff.Added {
+		added = append(added, title.ShowID)
+	}
+	if !reflect.DeepEqual(added, []string{"s5"}) {
+		t.Errorf("got added %q; want [s5]", added)
+	}
+
+	changed := map[int64][]string{}
+	for _, change := range diff.Changed {
+		fields := []string{}
+		for field := range change.Fields {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+		changed[change.ID] = fields
+		if change.New.ID != change.ID {
+			t.Errorf("change %d: got new values with id %d; want %d", change.ID, change.New.ID, change.ID)
+		}
+	}
+	wantChanged := map[int64][]string{
+		2: {"rating"},
+		4: {"date_added", "description", "rating", "show_id", "title"},
+	}
+	if !reflect.DeepEqual(changed, wantChanged) {
+		t.Errorf("got changed fields %v; want %v", changed, wantChanged)
+	}
+	if got := diff.Changed[0].Fields["rating"]; got != (FieldChange{Old: "TV-14", New: "TV-MA"}) {
+		t.Errorf("got rating change %+v; want TV-14 to TV-MA", got)
+	}
+
+	// only titles imported from the dataset are removed, so Okja is left alone
+	if got := diff.RemovedIDs(); !reflect.DeepEqual(got, []int64{3}) {
+		t.Errorf("got removed ids %v; want [3]", got)
+	}
+
+	rejected := map[int][]string{}
+	for _, row := range diff.Rejected {
+		for field := range row.Errors {
+			rejected[row.Row] = append(rejected[row.Row], field)
+		}
+	}
+	wantRejected := map[int][]string{6: {"show_id"}, 7: {"release_year"}, 8: {"date_added"}}
+	if !reflect.DeepEqual(rejected, wantRejected) {
+		t.Errorf("got rejected rows %v; want %v", rejected, wantRejected)
+	}
+}
+
+func TestCompareInvalidCSV(t *testing.T) {
+	_, err := Compare(strings.NewReader("show_id,title\ns1,Roma\n"), nil)
+	if !errors.Is(err, ErrInvalidCSV) {
+		t.Errorf("got error %v; want ErrInvalidCSV", err)
+	}
+}
+
+func TestMatchKey(t *testing.T) {
+	roma := &data.CatalogTitle{Title: data.Title{TitleType: "Movie", Title: "Roma", ReleaseYear: 2018}}
+
+	tests := []struct {
+		name  string
+		title *data.CatalogTitle
+		match bool
+	}{
+		{"same", &data.CatalogTitle{Title: data.Title{TitleType: "Movie", Title: "Roma", ReleaseYear: 2018}}, true},
+		{"different case", &data.CatalogTitle{Title: data.Title{TitleType: "MOVIE", Title: "roma", ReleaseYear: 2018}}, true},
+		{"other fields ignored", &data.CatalogTitle{Title: data.Title{TitleType: "Movie", Title: "Roma", Director: "Unknown", ReleaseYear: 2018}, ShowID: "s4"}, true},
+		{"different title", &data.CatalogTitle{Title: data.Title{TitleType: "Movie", Title: "Roma 2", ReleaseYear: 2018}}, false},
+		{"different type", &data.CatalogTitle{Title: data.Title{TitleType: "TV Show", Title: "Roma", ReleaseYear: 2018}}, false},
+		{"different year", &data.CatalogTitle{Title: data.Title{TitleType: "Movie", Title: "Roma", ReleaseYear: 2019}}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := matchKey(tt.title) == matchKey(roma); got != tt.match {
+				t.Errorf("got match %t; want %t", got, tt.match)
+			}
+		})
+	}
+}
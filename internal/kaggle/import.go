@@ -0,0 +1,87 @@
+package kaggle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"danielmatsuda15.rest/internal/data"
+	"danielmatsuda15.rest/internal/validator"
+)
+
+// ErrInvalidCSV wraps the errors returned by Import() when the CSV itself can't be read, as opposed to a
+// problem with the database.
+var ErrInvalidCSV = errors.New("invalid CSV")
+
+// RowResult identifies a row of the CSV that wasn't inserted, and why.
+type RowResult struct {
+	Row    int               `json:"row"`
+	ShowID string            `json:"show_id,omitempty"`
+	Errors map[string]string `json:"errors,omitempty"`
+}
+
+// Report describes the outcome of an import. Skipped rows have a show_id that's already in the titles table
+// (or earlier in the CSV), and rejected rows failed validation.
+type Report struct {
+	Inserted int         `json:"inserted"`
+	Skipped  []RowResult `json:"skipped"`
+	Rejected []RowResult `json:"rejected"`
+}
+
+// Import reads the dataset CSV from src, and copies its new, valid titles into the titles table in a single
+// transaction. The rows are streamed to PostgreSQL as they're read, rather than being held in memory. The
+// import is rolled back if ctx is canceled.
+func Import(ctx context.Context, src io.Reader, titles data.TitleRepository) (*Report, error) {
+	reader, err := NewReader(src)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCSV, err)
+	}
+
+	importer, err := titles.NewImporter(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer importer.Close()
+
+	report := &Report{Skipped: []RowResult{}, Rejected: []RowResult{}}
+	for {
+		title, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		// rows that can't be converted or don't pass validation are rejected, and the import carries on
+		var rowErr *RowError
+		switch {
+		case errors.As(err, &rowErr):
+			report.Rejected = append(report.Rejected, RowResult{Row: rowErr.Row, ShowID: rowErr.ShowID, Errors: rowErr.Errors})
+			continue
+		case err != nil:
+			return nil, fmt.Errorf("%w: %v", ErrInvalidCSV, err)
+		}
+
+		v := validator.New()
+		if data.ValidateTitle(v, &title.Title); !v.Valid() {
+			report.Rejected = append(report.Rejected, RowResult{Row: reader.Row(), ShowID: title.ShowID, Errors: v.Errors})
+			continue
+		}
+
+		added, err := importer.Add(title)
+		if err != nil {
+			return nil, err
+		}
+		if !added {
+			report.Skipped = append(report.Skipped, RowResult{Row: reader.Row(), ShowID: title.ShowID})
+			continue
+		}
+		report.Inserted++
+	}
+
+	err = importer.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
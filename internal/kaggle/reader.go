@@ -0,0 +1,150 @@
+// Package kaggle reads the Netflix catalog dataset in the raw CSV format published on Kaggle:
+// https://www.kaggle.com/shivamb/netflix-shows
+package kaggle
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"danielmatsuda15.rest/internal/data"
+)
+
+// dateAddedLayout is the format of the dataset's date_added column, e.g. "September 25, 2021".
+const dateAddedLayout = "January 2, 2006"
+
+// columns lists the dataset's columns that are loaded into the titles table. The dataset's other columns
+// (cast, duration and listed_in) are ignored, as are any extra columns.
+var columns = []string{
+	"show_id", "type", "title", "director", "country", "date_added", "release_year", "rating", "description",
+}
+
+// RowError is returned by Read() for a row that can't be converted to a title. The Reader can keep reading
+// after a RowError.
+type RowError struct {
+	Row    int
+	ShowID string
+	Errors map[string]string
+}
+
+func (e *RowError) Error() string {
+	return fmt.Sprintf("row %d is invalid", e.Row)
+}
+
+// Reader reads titles from the raw dataset CSV.
+type Reader struct {
+	csv     *csv.Reader
+	fields  int
+	indexes map[string]int
+	row     int
+}
+
+// NewReader creates a Reader for src, and reads its header row. Returns an error if a required column is
+// missing from the header.
+func NewReader(src io.Reader) (*Reader, error) {
+	r := &Reader{csv: csv.NewReader(src), indexes: make(map[string]int)}
+	// rows with the wrong number of fields are reported as a RowError instead of stopping the read
+	r.csv.FieldsPerRecord = -1
+
+	header, err := r.csv.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, errors.New("CSV must not be empty")
+		}
+		return nil, err
+	}
+	r.row = 1
+	r.fields = len(header)
+
+	for i, column := range header {
+		// strip the byte order mark that spreadsheet apps may add to the first column
+		column = strings.TrimPrefix(column, "\ufeff")
+		r.indexes[strings.TrimSpace(strings.ToLower(column))] = i
+	}
+	for _, column := range columns {
+		if _, ok := r.indexes[column]; !ok {
+			return nil, fmt.Errorf("CSV header is missing the %s column", column)
+		}
+	}
+
+	return r, nil
+}
+
+// Row returns the number of the row last read, counting the header as row 1.
+func (r *Reader) Row() int {
+	return r.row
+}
+
+// Read returns the next title in the CSV, or io.EOF once every row has been read. A row that can't be
+// converted returns a *RowError. The title isn't validated with data.ValidateTitle().
+func (r *Reader) Read() (*data.CatalogTitle, error) {
+	record, err := r.csv.Read()
+	if err != nil {
+		return nil, err
+	}
+	r.row++
+
+	rowErr := &RowError{Row: r.row, Errors: make(map[string]string)}
+	if len(record) != r.fields {
+		rowErr.Errors["row"] = fmt.Sprintf("must have %d fields", r.fields)
+		return nil, rowErr
+	}
+	field := func(column string) string {
+		return strings.TrimSpace(record[r.indexes[column]])
+	}
+	rowErr.ShowID = field("show_id")
+
+	title := &data.CatalogTitle{
+		Title: data.Title{
+			TitleType: field("type"),
+			Title:     field("title"),
+			Director:  field("director"),
+			Country:   field("country"),
+		},
+		ShowID:      field("show_id"),
+		Rating:      field("rating"),
+		Description: field("description"),
+	}
+
+	if title.ShowID == "" {
+		rowErr.Errors["show_id"] = "must be provided"
+	}
+
+	// the titles table defaults missing directors and countries to "Unknown"
+	if title.Director == "" {
+		title.Director = "Unknown"
+	}
+	if title.Country == "" {
+		title.Country = "Unknown"
+	}
+
+	if year := field("release_year"); year != "" {
+		releaseYear, err := strconv.ParseInt(year, 10, 32)
+		if err != nil {
+			rowErr.Errors["release_year"] = "must be an integer value"
+		}
+		title.ReleaseYear = int32(releaseYear)
+	}
+
+	if date := field("date_added"); date != "" {
+		dateAdded, err := time.Parse(dateAddedLayout, date)
+		if err != nil {
+			rowErr.Errors["date_added"] = "must be a date like " + dateAddedLayout
+		}
+		title.DateAdded = &dateAdded
+	}
+
+	// a few rows in the dataset have their duration (e.g. "74 min") in the rating column
+	if strings.HasSuffix(title.Rating, " min") {
+		title.Rating = ""
+	}
+
+	if len(rowErr.Errors) > 0 {
+		return nil, rowErr
+	}
+	return title, nil
+}
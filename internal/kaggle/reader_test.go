@@ -0,0 +1,180 @@
+package kaggle
+
+import (
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"danielmatsuda15.rest/internal/data"
+)
+
+// header is the header row of the raw Kaggle CSV, including the columns that aren't loaded.
+const header = "show_id,type,title,director,cast,country,date_added,release_year,rating,duration,listed_in,description\n"
+
+func date(year int, month time.Month, day int) *time.Time {
+	d := time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+	return &d
+}
+
+func TestReaderRead(t *testing.T) {
+	tests := []struct {
+		name       string
+		row        string
+		want       *data.CatalogTitle
+		wantErrors map[string]string
+	}{
+		{
+			name: "every column",
+			row:  `s1,Movie,Dick Johnson Is Dead,Kirsten Johnson,,United States,"September 25, 2021",2020,PG-13,90 min,Documentaries,"As her father nears the end of his life, filmmaker Kirsten Johnson stages his death."`,
+			want: &data.CatalogTitle{
+				Title:       data.Title{TitleType: "Movie", Title: "Dick Johnson Is Dead", Director: "Kirsten Johnson", Country: "United States", ReleaseYear: 2020},
+				ShowID:      "s1",
+				DateAdded:   date(2021, time.September, 25),
+				Rating:      "PG-13",
+				Description: "As her father nears the end of his life, filmmaker Kirsten Johnson stages his death.",
+			},
+		},
+		{
+			name: "missing director, country and date",
+			row:  `s2,TV Show,Blood & Water,,"Ama Qamata, Khosi Ngema",,,2021,TV-MA,2 Seasons,International TV Shows,After crossing paths at a party.`,
+			want: &data.CatalogTitle{
+				Title:       data.Title{TitleType: "TV Show", Title: "Blood & Water", Director: "Unknown", Country: "Unknown", ReleaseYear: 2021},
+				ShowID:      "s2",
+				Rating:      "TV-MA",
+				Description: "After crossing paths at a party.",
+			},
+		},
+		{
+			name: "duration in the rating column",
+			row:  `s5542,Movie,Louis C.K. 2017,Louis C.K.,Louis C.K.,United States,"April 4, 2017",2017,74 min,,Movies,Louis C.K. muses on religion.`,
+			want: &data.CatalogTitle{
+				Title:       data.Title{TitleType: "Movie", Title: "Louis C.K. 2017", Director: "Louis C.K.", Country: "United States", ReleaseYear: 2017},
+				ShowID:      "s5542",
+				DateAdded:   date(2017, time.April, 4),
+				Description: "Louis C.K. muses on religion.",
+			},
+		},
+		{
+			name: "date with surrounding spaces",
+			row:  `s7,Movie,My Little Pony,Robert Cullen,,,"  September 24, 2021 ",2021,PG,91 min,Children & Family Movies,Equestria's divided.`,
+			want: &data.CatalogTitle{
+				Title:       data.Title{TitleType: "Movie", Title: "My Little Pony", Director: "Robert Cullen", Country: "Unknown", ReleaseYear: 2021},
+				ShowID:      "s7",
+				DateAdded:   date(2021, time.September, 24),
+				Rating:      "PG",
+				Description: "Equestria's divided.",
+			},
+		},
+		{
+			name:       "invalid date",
+			row:        `s8,Movie,Sankofa,Haile Gerima,,United States,2021-09-24,1993,TV-MA,125 min,Dramas,On a photo shoot in Ghana.`,
+			wantErrors: map[string]string{"date_added": "must be a date like " + dateAddedLayout},
+		},
+		{
+			name:       "invalid year",
+			row:        `s9,Movie,Sankofa,Haile Gerima,,United States,"September 24, 2021",19x3,TV-MA,125 min,Dramas,On a photo shoot in Ghana.`,
+			wantErrors: map[string]string{"release_year": "must be an integer value"},
+		},
+		{
+			name:       "missing show_id",
+			row:        `,Movie,Sankofa,Haile Gerima,,United States,"September 24, 2021",1993,TV-MA,125 min,Dramas,On a photo shoot in Ghana.`,
+			wantErrors: map[string]string{"show_id": "must be provided"},
+		},
+		{
+			name:       "wrong number of fields",
+			row:        `s10,Movie,Sankofa`,
+			wantErrors: map[string]string{"row": "must have 12 fields"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := NewReader(strings.NewReader(header + tt.row + "\n"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			title, err := r.Read()
+			if tt.wantErrors != nil {
+				var rowErr *RowError
+				if !errors.As(err, &rowErr) {
+					t.Fatalf("got error %v; want a *RowError", err)
+				}
+				if rowErr.Row != 2 {
+					t.Errorf("got row %d; want 2", rowErr.Row)
+				}
+				if !reflect.DeepEqual(rowErr.Errors, tt.wantErrors) {
+					t.Errorf("got errors %v; want %v", rowErr.Errors, tt.wantErrors)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(title, tt.want) {
+				t.Errorf("got %+v; want %+v", title, tt.want)
+			}
+			if _, err := r.Read(); !errors.Is(err, io.EOF) {
+				t.Errorf("got error %v after the last row; want io.EOF", err)
+			}
+		})
+	}
+}
+
+func TestNewReaderHeader(t *testing.T) {
+	tests := []struct {
+		name    string
+		csv     string
+		want    *data.CatalogTitle
+		wantErr string
+	}{
+		{
+			name: "reordered columns with a byte order mark",
+			csv:  "\ufeffTitle,Show_ID,release_year,type,description,rating,date_added,country,director\nRoma,s1,2018,Movie,A year in the life.,R,\"December 14, 2018\",Mexico,Alfonso Cuarón\n",
+			want: &data.CatalogTitle{
+				Title:       data.Title{TitleType: "Movie", Title: "Roma", Director: "Alfonso Cuarón", Country: "Mexico", ReleaseYear: 2018},
+				ShowID:      "s1",
+				DateAdded:   date(2018, time.December, 14),
+				Rating:      "R",
+				Description: "A year in the life.",
+			},
+		},
+		{
+			name:    "empty",
+			csv:     "",
+			wantErr: "CSV must not be empty",
+		},
+		{
+			name:    "missing column",
+			csv:     "show_id,type,title,director,country,date_added,release_year,description\n",
+			wantErr: "CSV header is missing the rating column",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := NewReader(strings.NewReader(tt.csv))
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Errorf("got error %v; want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			title, err := r.Read()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(title, tt.want) {
+				t.Errorf("got %+v; want %+v", title, tt.want)
+			}
+		})
+	}
+}
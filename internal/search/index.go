@@ -0,0 +1,282 @@
+// Package search implements an in-process search index over the titles table. It's an alternative to
+// PostgreSQL full text search for read-heavy deployments, selected with the -search-backend=embedded flag.
+package search
+
+import (
+	"math"
+	"sort"
+	"sync"
+
+	"danielmatsuda15.rest/internal/data"
+)
+
+// BM25 tuning parameters, using the common defaults.
+// See https://en.wikipedia.org/wiki/Okapi_BM25
+const (
+	k1 = 1.2
+	b  = 0.75
+)
+
+// field holds the inverted index for one text field of the titles.
+type field struct {
+	postings    map[string]map[int64]int // term -> title id -> term frequency
+	lengths     map[int64]int            // title id -> number of terms
+	totalLength int
+}
+
+func newField() *field {
+	return &field{
+		postings: make(map[string]map[int64]int),
+		lengths:  make(map[int64]int),
+	}
+}
+
+func (f *field) add(id int64, text string) {
+	terms := data.Tokenize(text)
+	for _, term := range terms {
+		if f.postings[term] == nil {
+			f.postings[term] = make(map[int64]int)
+		}
+		f.postings[term][id]++
+	}
+	f.lengths[id] = len(terms)
+	f.totalLength += len(terms)
+}
+
+func (f *field) remove(id int64, text string) {
+	for _, term := range data.Tokenize(text) {
+		delete(f.postings[term], id)
+		if len(f.postings[term]) == 0 {
+			delete(f.postings, term)
+		}
+	}
+	f.totalLength -= f.lengths[id]
+	delete(f.lengths, id)
+}
+
+// score returns the BM25 score of the title with the given id for the terms in query.
+func (f *field) score(id int64, query string) float64 {
+	n := float64(len(f.lengths))
+	if n == 0 {
+		return 0
+	}
+	avgLength := float64(f.totalLength) / n
+
+	var score float64
+	for _, term := range data.Tokenize(query) {
+		tf := float64(f.postings[term][id])
+		if tf == 0 {
+			continue
+		}
+		df := float64(len(f.postings[term]))
+		idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+		score += idf * tf * (k1 + 1) / (tf + k1*(1-b+b*float64(f.lengths[id])/avgLength))
+	}
+	return score
+}
+
+// Index is an in-memory copy of the titles table, with an inverted index over its text fields. It
+// implements data.TitleObserver, so it can be kept in sync with writes made through data.TitleModel.
+// All methods are safe for concurrent use.
+type Index struct {
+	mu     sync.RWMutex
+	titles map[int64]data.Title
+	fields map[string]*field
+
+	// pending records the writes observed while Rebuild loads the titles, with nil for a deleted title.
+	// rebuildMu lets only one Rebuild run at a time
+	rebuildMu sync.Mutex
+	pending   map[int64]*data.Title
+}
+
+// New creates an empty Index.
+func New() *Index {
+	i := &Index{}
+	i.reset()
+	return i
+}
+
+func (i *Index) reset() {
+	i.titles = make(map[int64]data.Title)
+	i.fields = map[string]*field{
+		"title":    newField(),
+		"director": newField(),
+		"country":  newField(),
+	}
+}
+
+// Build replaces the contents of the index with titles.
+func (i *Index) Build(titles []*data.Title) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.reset()
+	for _, title := range titles {
+		i.add(title)
+	}
+}
+
+// Rebuild replaces the contents of the index with the titles returned by load, like Build, while the index
+// keeps serving searches. The writes observed while load runs are applied on top of its titles, since they
+// may not be included in them.
+func (i *Index) Rebuild(load func() ([]*data.Title, error)) error {
+	i.rebuildMu.Lock()
+	defer i.rebuildMu.Unlock()
+
+	i.mu.Lock()
+	i.pending = make(map[int64]*data.Title)
+	i.mu.Unlock()
+
+	titles, err := load()
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	pending := i.pending
+	i.pending = nil
+	if err != nil {
+		return err
+	}
+
+	i.reset()
+	for _, title := range titles {
+		i.add(title)
+	}
+	for id, title := range pending {
+		i.remove(id)
+		if title != nil {
+			i.add(title)
+		}
+	}
+	return nil
+}
+
+// Len returns the number of titles in the index.
+func (i *Index) Len() int {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	return len(i.titles)
+}
+
+// TitleSaved adds title to the index, replacing any older copy with the same id.
+func (i *Index) TitleSaved(title *data.Title) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.remove(title.ID)
+	i.add(title)
+	if i.pending != nil {
+		c := *title
+		i.pending[title.ID] = &c
+	}
+}
+
+// TitleDeleted removes the title with the given id from the index.
+func (i *Index) TitleDeleted(id int64) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.remove(id)
+	if i.pending != nil {
+		i.pending[id] = nil
+	}
+}
+
+func (i *Index) add(title *data.Title) {
+	i.titles[title.ID] = *title
+	i.fields["title"].add(title.ID, title.Title)
+	i.fields["director"].add(title.ID, title.Director)
+	i.fields["country"].add(title.ID, title.Country)
+}
+
+func (i *Index) remove(id int64) {
+	title, ok := i.titles[id]
+	if !ok {
+		return
+	}
+	i.fields["title"].remove(id, title.Title)
+	i.fields["director"].remove(id, title.Director)
+	i.fields["country"].remove(id, title.Country)
+	delete(i.titles, id)
+}
+
+// Search returns the titles that match filters, the same way data.TitleModel.GetAll() does. If any filter
+// is a full text search, the titles are ranked by their BM25 score, best first. Otherwise, or for equal
+// scores, they're ordered by id.
+func (i *Index) Search(filters data.TitleFilters) []*data.Title {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	ids := i.match(filters)
+
+	// sum the scores of every full text search filter
+	scores := make(map[int64]float64)
+	for _, id := range ids {
+		if filters.Title != "" && filters.TitleMatch == data.MatchFTS {
+			scores[id] += i.fields["title"].score(id, filters.Title)
+		}
+		if filters.Director != "" && filters.DirectorMatch == data.MatchFTS {
+			scores[id] += i.fields["director"].score(id, filters.Director)
+		}
+		if filters.Country != "" {
+			scores[id] += i.fields["country"].score(id, filters.Country)
+		}
+	}
+	sort.Slice(ids, func(x, y int) bool {
+		if scores[ids[x]] != scores[ids[y]] {
+			return scores[ids[x]] > scores[ids[y]]
+		}
+		return ids[x] < ids[y]
+	})
+
+	// return copies, so callers can't modify the index's titles
+	titles := make([]*data.Title, 0, len(ids))
+	for _, id := range ids {
+		title := i.titles[id]
+		titles = append(titles, &title)
+	}
+	return titles
+}
+
+// Facets returns up to limit of the most common values of each of the given fields, among the titles
+// that match filters. See data.FacetFields for the fields that can be faceted.
+func (i *Index) Facets(filters data.TitleFilters, fields []string, limit int) map[string][]data.FacetCount {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	counter := data.NewFacetCounter(fields)
+	for _, id := range i.match(filters) {
+		title := i.titles[id]
+		counter.Add(&title)
+	}
+	return counter.Result(limit)
+}
+
+// match returns the ids of the titles that match filters. A full text search on the title narrows the
+// candidates down to the titles containing its first word, before the remaining filters are checked.
+func (i *Index) match(filters data.TitleFilters) []int64 {
+	ids := []int64{}
+
+	if filters.Title != "" && filters.TitleMatch == data.MatchFTS {
+		terms := data.Tokenize(filters.Title)
+		if len(terms) == 0 {
+			return ids
+		}
+		for id := range i.fields["title"].postings[terms[0]] {
+			title := i.titles[id]
+			if filters.Matches(&title) {
+				ids = append(ids, id)
+			}
+		}
+		return ids
+	}
+
+	for id, title := range i.titles {
+		title := title
+		if filters.Matches(&title) {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
@@ -0,0 +1,199 @@
+package search
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"danielmatsuda15.rest/internal/data"
+)
+
+func testTitles() []*data.Title {
+	return []*data.Title{
+		{ID: 1, TitleType: "Movie", Title: "The Dark Knight", Director: "Christopher Nolan", Country: "United States, United Kingdom", ReleaseYear: 2008},
+		{ID: 2, TitleType: "TV Show", Title: "Dark", Director: "Baran bo Odar", Country: "Germany", ReleaseYear: 2017},
+		{ID: 3, TitleType: "Movie", Title: "Dark Waters", Director: "Todd Haynes", Country: "United States", ReleaseYear: 2019},
+		{ID: 4, TitleType: "Movie", Title: "Inception", Director: "Christopher Nolan", Country: "United States, United Kingdom", ReleaseYear: 2010},
+		{ID: 5, TitleType: "Movie", Title: "Knight and Day", Director: "James Mangold", Country: "United States", ReleaseYear: 2010},
+	}
+}
+
+func newTestIndex() *Index {
+	i := New()
+	i.Build(testTitles())
+	return i
+}
+
+// ids returns the ids of titles, in order.
+func ids(titles []*data.Title) []int64 {
+	ids := []int64{}
+	for _, title := range titles {
+		ids = append(ids, title.ID)
+	}
+	return ids
+}
+
+func TestSearchFilters(t *testing.T) {
+	i := newTestIndex()
+
+	tests := []struct {
+		name    string
+		filters data.TitleFilters
+		want    []int64
+	}{
+		{"no filters", data.TitleFilters{}, []int64{1, 2, 3, 4, 5}},
+		{"title exact", data.TitleFilters{Title: "dark", TitleMatch: data.MatchExact}, []int64{2}},
+		{"title prefix", data.TitleFilters{Title: "Dark", TitleMatch: data.MatchPrefix}, []int64{2, 3}},
+		{"title contains", data.TitleFilters{Title: "knight", TitleMatch: data.MatchContains}, []int64{1, 5}},
+		{"title fts needs every word", data.TitleFilters{Title: "dark knight", TitleMatch: data.MatchFTS}, []int64{1}},
+		{"title fts no match", data.TitleFilters{Title: "batman", TitleMatch: data.MatchFTS}, []int64{}},
+		{"title fts no words", data.TitleFilters{Title: "!!", TitleMatch: data.MatchFTS}, []int64{}},
+		{"director exact", data.TitleFilters{Director: "christopher nolan", DirectorMatch: data.MatchExact}, []int64{1, 4}},
+		{"title type", data.TitleFilters{TitleType: "tv show"}, []int64{2}},
+		{"country", data.TitleFilters{Country: "Germany"}, []int64{2}},
+		{"combined", data.TitleFilters{TitleType: "Movie", Director: "christopher", DirectorMatch: data.MatchPrefix}, []int64{1, 4}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ids(i.Search(tt.filters))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got ids %v; want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSearchRanking(t *testing.T) {
+	i := newTestIndex()
+
+	tests := []struct {
+		name    string
+		filters data.TitleFilters
+		want    []int64
+	}{
+		// every match has the term once, so the shortest titles score highest
+		{"shorter titles first", data.TitleFilters{Title: "dark", TitleMatch: data.MatchFTS}, []int64{2, 3, 1}},
+		{"ranked after filtering", data.TitleFilters{Title: "dark", TitleMatch: data.MatchFTS, TitleType: "Movie"}, []int64{3, 1}},
+		{"equal scores by id", data.TitleFilters{Director: "christopher nolan", DirectorMatch: data.MatchFTS}, []int64{1, 4}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ids(i.Search(tt.filters))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got ids %v; want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScore(t *testing.T) {
+	f := newField()
+	f.add(1, "dark")
+	f.add(2, "dark dark")
+	f.add(3, "knight")
+
+	if f.score(3, "dark") != 0 {
+		t.Errorf("got score %v for a title without the term; want 0", f.score(3, "dark"))
+	}
+	if f.score(2, "dark") <= f.score(1, "dark") {
+		t.Errorf("got score %v for the term twice, %v for once; want a higher score for twice", f.score(2, "dark"), f.score(1, "dark"))
+	}
+	// "knight" is rarer than "dark", so it's weighted higher
+	if f.score(3, "knight") <= f.score(1, "dark") {
+		t.Errorf("got score %v for a rare term, %v for a common one; want a higher score for the rare term", f.score(3, "knight"), f.score(1, "dark"))
+	}
+}
+
+func TestFacets(t *testing.T) {
+	i := newTestIndex()
+
+	tests := []struct {
+		name    string
+		filters data.TitleFilters
+		fields  []string
+		limit   int
+		want    map[string][]data.FacetCount
+	}{
+		{
+			name:    "lists split and ties by value",
+			filters: data.TitleFilters{Director: "Christopher Nolan", DirectorMatch: data.MatchExact},
+			fields:  []string{"country", "release_year"},
+			want: map[string][]data.FacetCount{
+				"country":      {{Value: "United Kingdom", Count: 2}, {Value: "United States", Count: 2}},
+				"release_year": {{Value: "2008", Count: 1}, {Value: "2010", Count: 1}},
+			},
+		},
+		{
+			name:   "limit",
+			fields: []string{"title_type", "country"},
+			limit:  1,
+			want: map[string][]data.FacetCount{
+				"title_type": {{Value: "Movie", Count: 4}},
+				"country":    {{Value: "United States", Count: 4}},
+			},
+		},
+		{
+			name:    "no matches",
+			filters: data.TitleFilters{Title: "batman", TitleMatch: data.MatchFTS},
+			fields:  []string{"director"},
+			want:    map[string][]data.FacetCount{"director": {}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := i.Facets(tt.filters, tt.fields, tt.limit)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v; want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestObserveWrites(t *testing.T) {
+	i := newTestIndex()
+	dark := data.TitleFilters{Title: "dark", TitleMatch: data.MatchFTS}
+
+	i.TitleSaved(&data.Title{ID: 2, TitleType: "TV Show", Title: "Bright", Director: "Baran bo Odar", Country: "Germany", ReleaseYear: 2017})
+	if got := ids(i.Search(dark)); !reflect.DeepEqual(got, []int64{3, 1}) {
+		t.Errorf("after an update, got ids %v; want [3 1]", got)
+	}
+
+	i.TitleDeleted(3)
+	if got := ids(i.Search(dark)); !reflect.DeepEqual(got, []int64{1}) {
+		t.Errorf("after a delete, got ids %v; want [1]", got)
+	}
+	if i.Len() != 4 {
+		t.Errorf("got %d titles; want 4", i.Len())
+	}
+}
+
+func TestRebuild(t *testing.T) {
+	i := newTestIndex()
+
+	// writes made while the titles are loaded are kept, even though load doesn't return them
+	err := i.Rebuild(func() ([]*data.Title, error) {
+		i.TitleSaved(&data.Title{ID: 6, TitleType: "Movie", Title: "Dark City", Director: "Alex Proyas", Country: "Australia", ReleaseYear: 1998})
+		i.TitleDeleted(1)
+		return testTitles(), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ids(i.Search(data.TitleFilters{})); !reflect.DeepEqual(got, []int64{2, 3, 4, 5, 6}) {
+		t.Errorf("got ids %v; want [2 3 4 5 6]", got)
+	}
+
+	// a failed load leaves the index as it was
+	err = i.Rebuild(func() ([]*data.Title, error) {
+		return nil, errors.New("load failed")
+	})
+	if err == nil {
+		t.Fatal("got nil error; want the load's error")
+	}
+	if i.Len() != 5 {
+		t.Errorf("got %d titles; want 5", i.Len())
+	}
+}
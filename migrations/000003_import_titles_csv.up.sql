@@ -1 +1,2 @@
-COPY titles(title_type, title, director, country, release_year) FROM '/home/ubuntu/trimmed_netflix_titles.csv' DELIMITER ',' CSV HEADER FORCE NOT NULL director, country;
\ No newline at end of file
+-- Titles used to be loaded here with COPY FROM a CSV file on the database server, which needed the
+-- pg_read_server_files role. They're now uploaded to the API with POST /v1/imports instead.
\ No newline at end of file
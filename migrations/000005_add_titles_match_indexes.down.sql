@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS titles_title_lower_idx;
+DROP INDEX IF EXISTS titles_director_lower_idx;
+DROP INDEX IF EXISTS titles_title_trgm_idx;
+DROP INDEX IF EXISTS titles_director_trgm_idx;
+DROP INDEX IF EXISTS titles_director_fts_idx;
\ No newline at end of file
@@ -0,0 +1,6 @@
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+CREATE INDEX IF NOT EXISTS titles_title_lower_idx ON titles (LOWER(title) text_pattern_ops);
+CREATE INDEX IF NOT EXISTS titles_director_lower_idx ON titles (LOWER(director) text_pattern_ops);
+CREATE INDEX IF NOT EXISTS titles_title_trgm_idx ON titles USING GIN (LOWER(title) gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS titles_director_trgm_idx ON titles USING GIN (LOWER(director) gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS titles_director_fts_idx ON titles USING GIN (to_tsvector('simple', director));
\ No newline at end of file
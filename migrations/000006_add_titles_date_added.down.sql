@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS titles_date_added_idx;
+ALTER TABLE titles DROP COLUMN IF EXISTS date_added;
\ No newline at end of file
@@ -0,0 +1,2 @@
+ALTER TABLE titles ADD COLUMN IF NOT EXISTS date_added date;
+CREATE INDEX IF NOT EXISTS titles_date_added_idx ON titles (date_added);
\ No newline at end of file
@@ -0,0 +1 @@
+ALTER TABLE titles DROP COLUMN IF EXISTS rating;
\ No newline at end of file
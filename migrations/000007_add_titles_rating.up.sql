@@ -0,0 +1 @@
+ALTER TABLE titles ADD COLUMN IF NOT EXISTS rating text;
\ No newline at end of file
@@ -0,0 +1 @@
+ALTER TABLE titles ADD COLUMN IF NOT EXISTS description text;
\ No newline at end of file
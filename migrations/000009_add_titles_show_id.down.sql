@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS titles_show_id_idx;
+ALTER TABLE titles DROP COLUMN IF EXISTS show_id;
\ No newline at end of file
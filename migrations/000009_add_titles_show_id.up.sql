@@ -0,0 +1,2 @@
+ALTER TABLE titles ADD COLUMN IF NOT EXISTS show_id text;
+CREATE UNIQUE INDEX IF NOT EXISTS titles_show_id_idx ON titles (show_id);
\ No newline at end of file
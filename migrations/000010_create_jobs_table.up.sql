@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS jobs (
+id bigserial PRIMARY KEY,
+kind text NOT NULL,
+status text NOT NULL DEFAULT 'queued',
+params jsonb NOT NULL DEFAULT '{}',
+input bytea,
+progress integer NOT NULL DEFAULT 0,
+result jsonb,
+output bytea,
+result_location text,
+error text,
+created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+started_at timestamp(0) with time zone,
+finished_at timestamp(0) with time zone,
+CONSTRAINT jobs_status_check CHECK (status IN ('queued', 'running', 'succeeded', 'failed')),
+CONSTRAINT jobs_progress_check CHECK (progress BETWEEN 0 AND 100)
+);
+CREATE INDEX IF NOT EXISTS jobs_queued_idx ON jobs (id) WHERE status = 'queued';
\ No newline at end of file
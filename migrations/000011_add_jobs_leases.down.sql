@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS jobs_running_idx;
+ALTER TABLE jobs DROP COLUMN IF EXISTS locked_until;
+ALTER TABLE jobs DROP COLUMN IF EXISTS worker_id;
\ No newline at end of file
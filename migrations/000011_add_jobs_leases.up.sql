@@ -0,0 +1,3 @@
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS worker_id text;
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS locked_until timestamp(0) with time zone;
+CREATE INDEX IF NOT EXISTS jobs_running_idx ON jobs (locked_until) WHERE status = 'running';
\ No newline at end of file
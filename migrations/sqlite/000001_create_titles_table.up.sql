@@ -0,0 +1,18 @@
+-- The SQLite schema matches the PostgreSQL one after all its migrations, except for the jobs table, since
+-- background jobs need PostgreSQL. Dates are stored as YYYY-MM-DD text.
+CREATE TABLE IF NOT EXISTS titles (
+id integer PRIMARY KEY AUTOINCREMENT,
+title_type text NOT NULL,
+title text NOT NULL,
+director text NOT NULL DEFAULT 'Unknown',
+country text NOT NULL DEFAULT 'Unknown',
+release_year integer NOT NULL CHECK (release_year >= 1888),
+date_added date,
+rating text,
+description text,
+show_id text
+);
+CREATE UNIQUE INDEX IF NOT EXISTS titles_show_id_idx ON titles (show_id);
+CREATE INDEX IF NOT EXISTS titles_title_lower_idx ON titles (LOWER(title));
+CREATE INDEX IF NOT EXISTS titles_director_lower_idx ON titles (LOWER(director));
+CREATE INDEX IF NOT EXISTS titles_date_added_idx ON titles (date_added);
@@ -0,0 +1,2 @@
+DROP TRIGGER IF EXISTS titles_year_check_insert;
+DROP TRIGGER IF EXISTS titles_year_check_update;
@@ -0,0 +1,14 @@
+-- The lower bound of titles_year_check is a CHECK constraint in 000001, but SQLite doesn't allow the current
+-- date in one, so the upper bound is enforced by triggers instead.
+CREATE TRIGGER IF NOT EXISTS titles_year_check_insert
+BEFORE INSERT ON titles
+WHEN NEW.release_year > CAST(strftime('%Y', 'now') AS integer)
+BEGIN
+	SELECT RAISE(ABORT, 'titles_year_check');
+END;
+CREATE TRIGGER IF NOT EXISTS titles_year_check_update
+BEFORE UPDATE OF release_year ON titles
+WHEN NEW.release_year > CAST(strftime('%Y', 'now') AS integer)
+BEGIN
+	SELECT RAISE(ABORT, 'titles_year_check');
+END;
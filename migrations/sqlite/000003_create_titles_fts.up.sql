@@ -0,0 +1,18 @@
+-- titles_fts stands in for PostgreSQL's to_tsvector('simple', ...) indexes. It's an external content FTS5
+-- table, so it only holds the index, and the triggers keep it in sync with the titles table. The API must
+-- be built with -tags sqlite_fts5 to query it.
+CREATE VIRTUAL TABLE IF NOT EXISTS titles_fts USING fts5(
+title, director, country,
+content='titles', content_rowid='id', tokenize='unicode61 remove_diacritics 0'
+);
+CREATE TRIGGER IF NOT EXISTS titles_fts_insert AFTER INSERT ON titles BEGIN
+	INSERT INTO titles_fts (rowid, title, director, country) VALUES (NEW.id, NEW.title, NEW.director, NEW.country);
+END;
+CREATE TRIGGER IF NOT EXISTS titles_fts_delete AFTER DELETE ON titles BEGIN
+	INSERT INTO titles_fts (titles_fts, rowid, title, director, country) VALUES ('delete', OLD.id, OLD.title, OLD.director, OLD.country);
+END;
+CREATE TRIGGER IF NOT EXISTS titles_fts_update AFTER UPDATE OF title, director, country ON titles BEGIN
+	INSERT INTO titles_fts (titles_fts, rowid, title, director, country) VALUES ('delete', OLD.id, OLD.title, OLD.director, OLD.country);
+	INSERT INTO titles_fts (rowid, title, director, country) VALUES (NEW.id, NEW.title, NEW.director, NEW.country);
+END;
+INSERT INTO titles_fts (titles_fts) VALUES ('rebuild');